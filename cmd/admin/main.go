@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/lib/pq"
+)
+
+const usage = `usage: admin COMMAND [flags]
+
+commands:
+  audit-verify                      walk the audit chain and report breaks
+  audit-export -key file -o file    write a signed NDJSON export of the audit events
+  audit-verify-export -pub file file
+                                    check the signature and chain of an export
+  keygen -o file                    generate an ed25519 key pair for signing exports
+
+The commands reading the database connect to DB_DSN.`
+
+// Administration tasks which don't belong in the API, e.g.
+//
+//	DB_DSN=... admin audit-verify
+//	DB_DSN=... admin audit-export -key ./audit.key -since 2026-01-01T00:00:00Z -o audit.ndjson
+//	admin audit-verify-export -pub ./audit.key.pub audit.ndjson
+//
+// Exits with status 1 if a verification fails.
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	command, args := os.Args[1], os.Args[2:]
+
+	switch command {
+	case "audit-verify":
+		auditVerify(args)
+	case "audit-export":
+		auditExport(args)
+	case "audit-verify-export":
+		auditVerifyExport(args)
+	case "keygen":
+		keygen(args)
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(2)
+	}
+}
+
+func auditVerify(args []string) {
+	flags := flag.NewFlagSet("audit-verify", flag.ExitOnError)
+	flags.Parse(args)
+
+	models := openModels()
+	defer models.DB.Close()
+
+	breaks, count, err := models.Audit.VerifyChain(context.Background())
+	if err != nil {
+		log.Fatalf("admin: failed to verify the audit chain: %v\n", err)
+	}
+
+	for _, b := range breaks {
+		fmt.Println(b)
+	}
+
+	fmt.Printf("%d audit events checked, %d breaks\n", count, len(breaks))
+
+	if len(breaks) > 0 {
+		os.Exit(1)
+	}
+}
+
+// auditExport writes the events of the time range as NDJSON, one event per line in
+// chain order, and the base64 encoded ed25519 signature of the file's SHA-256 digest to
+// the same path with ".sig" appended.
+func auditExport(args []string) {
+	flags := flag.NewFlagSet("audit-export", flag.ExitOnError)
+	keyFile := flags.String("key", "", "file with the base64 encoded ed25519 private key")
+	out := flags.String("o", "", "file to write the export to")
+	since := flags.String("since", "", "only events created at or after this RFC 3339 time")
+	until := flags.String("until", "", "only events created before this RFC 3339 time")
+	flags.Parse(args)
+
+	if *keyFile == "" || *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	key, err := readKey(*keyFile, ed25519.PrivateKeySize)
+	if err != nil {
+		log.Fatalf("admin: failed to read the signing key: %v\n", err)
+	}
+
+	where := []goqu.Expression{}
+	if *since != "" {
+		where = append(where, goqu.I("created_at").Gte(parseTime("since", *since)))
+	}
+	if *until != "" {
+		where = append(where, goqu.I("created_at").Lt(parseTime("until", *until)))
+	}
+
+	models := openModels()
+	defer models.DB.Close()
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+	defer f.Close()
+
+	digest := sha256.New()
+	w := bufio.NewWriter(io.MultiWriter(f, digest))
+	enc := json.NewEncoder(w)
+
+	count := 0
+	err = models.Audit.Each(context.Background(), where, func(event *data.AuditEvent) error {
+		count++
+		return enc.Encode(event)
+	})
+	if err != nil {
+		log.Fatalf("admin: failed to export the audit events: %v\n", err)
+	}
+
+	err = w.Flush()
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	signature := ed25519.Sign(ed25519.PrivateKey(key), digest.Sum(nil))
+
+	err = os.WriteFile(*out+".sig", []byte(base64.StdEncoding.EncodeToString(signature)+"\n"), 0644)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	fmt.Printf("%d audit events written to %s, signature in %s.sig\n", count, *out, *out)
+}
+
+// auditVerifyExport checks the signature of an export and that its events are
+// unaltered and consecutive. It doesn't need the database.
+func auditVerifyExport(args []string) {
+	flags := flag.NewFlagSet("audit-verify-export", flag.ExitOnError)
+	pubFile := flags.String("pub", "", "file with the base64 encoded ed25519 public key")
+	flags.Parse(args)
+
+	if *pubFile == "" || flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	export := flags.Arg(0)
+
+	pub, err := readKey(*pubFile, ed25519.PublicKeySize)
+	if err != nil {
+		log.Fatalf("admin: failed to read the public key: %v\n", err)
+	}
+
+	content, err := os.ReadFile(export)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	signature, err := readKey(export+".sig", ed25519.SignatureSize)
+	if err != nil {
+		log.Fatalf("admin: failed to read the signature: %v\n", err)
+	}
+
+	digest := sha256.Sum256(content)
+	if !ed25519.Verify(ed25519.PublicKey(pub), digest[:], signature) {
+		fmt.Println("signature is invalid")
+		os.Exit(1)
+	}
+
+	breaks := []data.AuditChainBreak{}
+	count := 0
+
+	var prev *data.AuditEvent
+
+	dec := json.NewDecoder(strings.NewReader(string(content)))
+	for dec.More() {
+		var event data.AuditEvent
+
+		err := dec.Decode(&event)
+		if err != nil {
+			log.Fatalf("admin: failed to read event %d: %v\n", count+1, err)
+		}
+		count++
+
+		b, err := data.CheckAuditLink(prev, &event)
+		if err != nil {
+			log.Fatalf("admin: %v\n", err)
+		}
+
+		breaks = append(breaks, b...)
+		prev = &event
+	}
+
+	for _, b := range breaks {
+		fmt.Println(b)
+	}
+
+	fmt.Printf("signature is valid, %d audit events checked, %d breaks\n", count, len(breaks))
+
+	if len(breaks) > 0 {
+		os.Exit(1)
+	}
+}
+
+// keygen writes a new ed25519 private key to the file, and its public key to the same
+// path with ".pub" appended.
+func keygen(args []string) {
+	flags := flag.NewFlagSet("keygen", flag.ExitOnError)
+	out := flags.String("o", "", "file to write the private key to")
+	flags.Parse(args)
+
+	if *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	err = os.WriteFile(*out, []byte(base64.StdEncoding.EncodeToString(key)+"\n"), 0600)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	err = os.WriteFile(*out+".pub", []byte(base64.StdEncoding.EncodeToString(pub)+"\n"), 0644)
+	if err != nil {
+		log.Fatalf("admin: %v\n", err)
+	}
+
+	fmt.Printf("private key written to %s, public key to %s.pub\n", *out, *out)
+}
+
+func openModels() data.Models {
+	db, err := sqlx.Connect("postgres", data.BypassRLSDSN(os.Getenv("DB_DSN")))
+	if err != nil {
+		log.Fatalf("admin: failed to open DB: %v\n", err)
+	}
+
+	return data.NewModels(db)
+}
+
+// readKey reads a base64 encoded key or signature of the given size from the file.
+func readKey(file string, size int) ([]byte, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) != size {
+		return nil, fmt.Errorf("expected %d bytes, got %d", size, len(key))
+	}
+
+	return key, nil
+}
+
+func parseTime(name, value string) time.Time {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		log.Fatalf("admin: -%s must be an RFC 3339 time: %v\n", name, err)
+	}
+
+	return t
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"expvar"
 	"flag"
 	"fmt"
@@ -11,7 +13,9 @@ import (
 	"time"
 
 	"github.com/hasahmad/go-skeleton/internal"
+	"github.com/hasahmad/go-skeleton/internal/authz"
 	"github.com/hasahmad/go-skeleton/internal/config"
+	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/jmoiron/sqlx"
 
 	log "github.com/sirupsen/logrus"
@@ -29,8 +33,8 @@ var (
 func main() {
 	cfg, err := config.InitByFlag()
 	if err != nil {
-		fmt.Errorf("sdf %s", err.Error())
-		os.Exit(0)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
 	displayVersion := flag.Bool("version", false, "Display version and exit")
@@ -48,7 +52,18 @@ func main() {
 	logger := log.New()
 	logger.SetFormatter(&log.JSONFormatter{})
 
-	db, err := OpenDB(cfg)
+	if cfg.Pagination.CursorSecret == "" {
+		secret := make([]byte, 32)
+		_, err := rand.Read(secret)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		cfg.Pagination.CursorSecret = hex.EncodeToString(secret)
+		logger.Warn("no pagination cursor secret set, the cursors won't survive a restart")
+	}
+
+	db, err := OpenDB(cfg, cfg.DB.DSN)
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -57,6 +72,33 @@ func main() {
 
 	logger.Info("database connection pool established")
 
+	var replicas *data.Replicas
+	if len(cfg.DB.ReplicaDSNs) > 0 {
+		pools := []*sqlx.DB{}
+		for _, dsn := range cfg.DB.ReplicaDSNs {
+			pool, err := OpenDB(cfg, dsn)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			pools = append(pools, pool)
+		}
+
+		replicas = data.NewReplicas(pools, cfg.DB.ReplicaStickiness)
+		defer replicas.Close()
+
+		logger.WithFields(log.Fields{"replicas": len(pools)}).Info("read replica connection pools established")
+	}
+
+	var enforcer *authz.Enforcer
+	if cfg.Authz.PolicyFile != "" {
+		enforcer, err = authz.NewEnforcer(cfg.Authz.PolicyFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		logger.WithFields(log.Fields{"file": cfg.Authz.PolicyFile}).Info("authorization policy loaded")
+	}
+
 	expvar.NewString("version").Set(version)
 
 	// Publish the number of active goroutines.
@@ -69,20 +111,30 @@ func main() {
 		return db.Stats()
 	}))
 
+	// Publish the connection pool statistics of the read replicas.
+	if replicas != nil {
+		expvar.Publish("database_replicas", expvar.Func(func() interface{} {
+			return replicas.Stats()
+		}))
+	}
+
 	// Publish the current Unix timestamp.
 	expvar.Publish("timestamp", expvar.Func(func() interface{} {
 		return time.Now().Unix()
 	}))
 
-	app := internal.NewApplication(logger, cfg, db, sync.WaitGroup{})
+	app := internal.NewApplication(logger, cfg, db, replicas, enforcer, &sync.WaitGroup{})
 	err = app.Serve()
 	if err != nil {
 		logger.Fatal(err)
 	}
 }
 
-func OpenDB(cfg config.Config) (*sqlx.DB, error) {
-	db, err := sqlx.Connect("postgres", cfg.DB.DSN)
+// OpenDB opens a connection pool to the database of the DSN, the primary or a replica.
+// Its connections bypass the row level security policies unless a transaction turns
+// the bypass off (see data.BypassRLSDSN).
+func OpenDB(cfg config.Config, dsn string) (*sqlx.DB, error) {
+	db, err := sqlx.Connect("postgres", data.BypassRLSDSN(dsn))
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/authz"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/jmoiron/sqlx"
+
+	_ "github.com/lib/pq"
+)
+
+// Checks what the authorization policy file decides for a request, e.g.
+//
+//	DB_DSN=... authz -policy ./policy.csv -user alice@example.com GET /v1/users
+//
+// Without -user the request is checked as an anonymous user and no database connection
+// is needed. Exits with status 1 unless the request is allowed.
+func main() {
+	flags := flag.NewFlagSet("authz", flag.ExitOnError)
+	policyFile := flags.String("policy", "", "authorization policy file")
+	login := flags.String("user", "", "email or id of the user (anonymous if empty)")
+
+	flags.Parse(os.Args[1:])
+	args := flags.Args()
+
+	if *policyFile == "" || len(args) != 2 {
+		fmt.Fprintln(os.Stderr, "usage: authz -policy file [-user email|id] METHOD /path")
+		flags.PrintDefaults()
+		os.Exit(2)
+	}
+
+	method, path := strings.ToUpper(args[0]), args[1]
+
+	enforcer, err := authz.NewEnforcer(*policyFile)
+	if err != nil {
+		log.Fatalf("authz: failed to load policy: %v\n", err)
+	}
+
+	user := data.AnonymousUser
+	var roles data.Roles
+
+	if *login != "" {
+		db, err := sqlx.Connect("postgres", data.BypassRLSDSN(os.Getenv("DB_DSN")))
+		if err != nil {
+			log.Fatalf("authz: failed to open DB: %v\n", err)
+		}
+		defer db.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		models := data.NewModels(db)
+
+		id, parseErr := uuid.Parse(*login)
+		if parseErr == nil {
+			user, err = models.Users.Get(ctx, id)
+		} else {
+			user, err = models.Users.GetByEmail(ctx, *login)
+		}
+		if err != nil {
+			log.Fatalf("authz: failed to load user %s: %v\n", *login, err)
+		}
+
+		roles, err = models.Roles.GetAllForUser(ctx, user.UserID)
+		if err != nil {
+			log.Fatalf("authz: failed to load roles: %v\n", err)
+		}
+	}
+
+	decision := enforcer.Enforce(authz.NewSubject(user, roles), method, path)
+
+	who := "anonymous"
+	if !user.IsAnonymousUser() {
+		who = fmt.Sprintf("%s (roles: %s)", user.Email, strings.Join(roles, ", "))
+	}
+
+	switch decision.Rule {
+	case nil:
+		fmt.Printf("%s %s as %s: %s, falls through to the route permission checks\n", method, path, who, decision.Effect)
+	default:
+		fmt.Printf("%s %s as %s: %s by %s\n", method, path, who, decision.Effect, decision.Rule)
+	}
+
+	if decision.Effect != authz.EffectAllow {
+		os.Exit(1)
+	}
+}
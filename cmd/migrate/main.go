@@ -7,6 +7,7 @@ import (
 
 	"github.com/pressly/goose/v3"
 
+	"github.com/hasahmad/go-skeleton/internal/data"
 	_ "github.com/hasahmad/go-skeleton/migrations"
 	_ "github.com/lib/pq"
 )
@@ -25,7 +26,7 @@ func main() {
 
 	command := args[0]
 
-	db, err := goose.OpenDBWithDriver("postgres", os.Getenv("DB_DSN"))
+	db, err := goose.OpenDBWithDriver("postgres", data.BypassRLSDSN(os.Getenv("DB_DSN")))
 	if err != nil {
 		log.Fatalf("goose: failed to open DB: %v\n", err)
 	}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"net/http"
 
+	"github.com/google/uuid"
+
 	"github.com/hasahmad/go-skeleton/internal/data"
 )
 
@@ -30,3 +32,112 @@ func ContextGetUser(r *http.Request) *data.User {
 
 	return user
 }
+
+const rolesContextKey = ContextKey("roles")
+
+// The roles and permissions of the current user depend on the active organization, so
+// they are stored along with the organization they were loaded for.
+type cachedRoles struct {
+	organizationID uuid.UUID
+	roles          data.Roles
+}
+
+type cachedPermissions struct {
+	organizationID uuid.UUID
+	permissions    data.Permissions
+}
+
+// ContextSetRoles returns a new copy of the request with the roles of the current user
+// added to the context, so they only have to be loaded once per request.
+func ContextSetRoles(r *http.Request, roles data.Roles) *http.Request {
+	ctx := context.WithValue(r.Context(), rolesContextKey, cachedRoles{
+		organizationID: contextOrganizationID(r),
+		roles:          roles,
+	})
+	return r.WithContext(ctx)
+}
+
+// ContextGetRoles returns the roles stored by ContextSetRoles, and false if they haven't
+// been loaded yet for this request and the active organization.
+func ContextGetRoles(r *http.Request) (data.Roles, bool) {
+	cached, ok := r.Context().Value(rolesContextKey).(cachedRoles)
+	if !ok || cached.organizationID != contextOrganizationID(r) {
+		return nil, false
+	}
+
+	return cached.roles, true
+}
+
+const permissionsContextKey = ContextKey("permissions")
+
+// ContextSetPermissions returns a new copy of the request with the effective permissions
+// of the current user added to the context.
+func ContextSetPermissions(r *http.Request, permissions data.Permissions) *http.Request {
+	ctx := context.WithValue(r.Context(), permissionsContextKey, cachedPermissions{
+		organizationID: contextOrganizationID(r),
+		permissions:    permissions,
+	})
+	return r.WithContext(ctx)
+}
+
+// ContextGetPermissions returns the permissions stored by ContextSetPermissions, and
+// false if they haven't been loaded yet for this request and the active organization.
+func ContextGetPermissions(r *http.Request) (data.Permissions, bool) {
+	cached, ok := r.Context().Value(permissionsContextKey).(cachedPermissions)
+	if !ok || cached.organizationID != contextOrganizationID(r) {
+		return nil, false
+	}
+
+	return cached.permissions, true
+}
+
+const tenantContextKey = ContextKey("tenant")
+
+// ContextSetTenant returns a new copy of the request with the active organization
+// (the tenant) added to the context. membership is nil when the user has access without
+// being a member (superusers).
+func ContextSetTenant(r *http.Request, org *data.Organization, membership *data.Membership) *http.Request {
+	ctx := context.WithValue(r.Context(), tenantContextKey, &Tenant{
+		Organization: org,
+		Membership:   membership,
+	})
+	return r.WithContext(ctx)
+}
+
+// Tenant is the active organization of a request.
+type Tenant struct {
+	Organization *data.Organization
+	Membership   *data.Membership
+}
+
+// ContextGetTenant returns the active organization, or nil if the request isn't
+// scoped to an organization.
+func ContextGetTenant(r *http.Request) *Tenant {
+	tenant, _ := r.Context().Value(tenantContextKey).(*Tenant)
+	return tenant
+}
+
+func contextOrganizationID(r *http.Request) uuid.UUID {
+	tenant := ContextGetTenant(r)
+	if tenant == nil {
+		return uuid.Nil
+	}
+
+	return tenant.Organization.OrganizationID
+}
+
+const policyAllowedContextKey = ContextKey("policy_allowed")
+
+// ContextSetPolicyAllowed marks the request as explicitly allowed by the authorization
+// policy file.
+func ContextSetPolicyAllowed(r *http.Request) *http.Request {
+	ctx := context.WithValue(r.Context(), policyAllowedContextKey, true)
+	return r.WithContext(ctx)
+}
+
+// ContextPolicyAllowed reports whether the authorization policy file explicitly allowed
+// the request and is configured to replace the route permission checks.
+func ContextPolicyAllowed(r *http.Request) bool {
+	allowed, _ := r.Context().Value(policyAllowedContextKey).(bool)
+	return allowed
+}
@@ -1,10 +1,12 @@
 package apierrors
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
 	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/sirupsen/logrus"
 )
 
@@ -22,6 +24,7 @@ func (e ErrorResponses) LogError(r *http.Request, err error) {
 	e.logger.WithFields(logrus.Fields{
 		"request_method": r.Method,
 		"request_url":    r.URL.String(),
+		"request_id":     data.AuditSourceFromContext(r.Context()).RequestID,
 	}).Error(err)
 }
 
@@ -35,13 +38,59 @@ func (e ErrorResponses) ErrorResponse(w http.ResponseWriter, r *http.Request, st
 	}
 }
 
+// ServerErrorResponse responds to an unexpected error, unless it is an error of the data
+// layer the client can act on (see DataErrorResponse).
 func (e ErrorResponses) ServerErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if e.DataErrorResponse(w, r, err) {
+		return
+	}
+
 	e.LogError(r, err)
 
 	message := "the server encountered a problem and could not process your request"
 	e.ErrorResponse(w, r, http.StatusInternalServerError, message)
 }
 
+// DataErrorResponse responds to the errors of the data layer the client can act on: 409
+// Conflict for the duplicates and the serialization failures, and 422 Unprocessable
+// Entity keyed by the field for the other constraint violations. It reports whether it
+// responded.
+func (e ErrorResponses) DataErrorResponse(w http.ResponseWriter, r *http.Request, err error) bool {
+	var constraintErr *data.ConstraintError
+
+	switch {
+	case errors.Is(err, data.ErrSerializationFailure):
+		e.EditConflictResponse(w, r)
+	case errors.As(err, &constraintErr):
+		// the names of the constraints would tell about the schema
+		field := constraintErr.Field
+		if field == "" {
+			field = "error"
+		}
+
+		switch constraintErr.Kind {
+		case data.ConstraintUnique:
+			e.ErrorResponse(w, r, http.StatusConflict, map[string]string{field: "already exists"})
+		case data.ConstraintForeignKey:
+			e.FailedValidationResponse(w, r, map[string]string{field: "refers to a record which doesn't exist"})
+		case data.ConstraintNotNull:
+			e.FailedValidationResponse(w, r, map[string]string{field: "must be provided"})
+		default:
+			e.FailedValidationResponse(w, r, map[string]string{field: "is invalid"})
+		}
+	default:
+		return false
+	}
+
+	e.logger.WithFields(logrus.Fields{
+		"request_method": r.Method,
+		"request_url":    r.URL.String(),
+		"request_id":     data.AuditSourceFromContext(r.Context()).RequestID,
+	}).Debug(err)
+
+	return true
+}
+
 func (e ErrorResponses) NotFoundResponse(w http.ResponseWriter, r *http.Request) {
 	message := "the requested resource could not be found"
 	e.ErrorResponse(w, r, http.StatusNotFound, message)
@@ -93,7 +142,22 @@ func (e ErrorResponses) InactiveAccountResponse(w http.ResponseWriter, r *http.R
 	e.ErrorResponse(w, r, http.StatusForbidden, message)
 }
 
+func (e ErrorResponses) AccountSuspendedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "your user account has been suspended"
+	e.ErrorResponse(w, r, http.StatusForbidden, message)
+}
+
 func (e ErrorResponses) NotPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	e.ErrorResponse(w, r, http.StatusForbidden, message)
 }
+
+func (e ErrorResponses) PreconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the resource has been modified since it was fetched, please fetch it again"
+	e.ErrorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+func (e ErrorResponses) PreconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	message := "this request must be conditional, set the If-Match header to the ETag of the resource"
+	e.ErrorResponse(w, r, http.StatusPreconditionRequired, message)
+}
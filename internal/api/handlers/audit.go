@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// auditEventFilters are the fields the audit events can be filtered on.
+var auditEventFilters = data.FilterSafelist{
+	"actor_id":        {Type: data.FilterUUID, Operators: append([]string{data.FilterIsNull}, data.UUIDFilterOperators...)},
+	"organization_id": {Type: data.FilterUUID, Operators: append([]string{data.FilterIsNull}, data.UUIDFilterOperators...)},
+	"action":          {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"target_type":     {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"target_id":       {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"request_id":      {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"created_at":      {Type: data.FilterTime, Operators: data.TimeFilterOperators},
+}
+
+func (h Handlers) ListAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	where := data.ParseFilterQuery(v, qs, auditEventFilters)
+
+	if since, ok := helpers.ReadTime(qs, "since", v); ok {
+		where = append(where, goqu.I("created_at").Gte(since))
+	}
+	if until, ok := helpers.ReadTime(qs, "until", v); ok {
+		where = append(where, goqu.I("created_at").Lt(until))
+	}
+
+	filters := h.readFilters(qs, v, "-created_at", []string{"created_at", "-created_at"})
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	events, metadata, err := h.models.Audit.GetAll(r.Context(), where, filters)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	setPageLinks(r, &metadata)
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"metadata": metadata, "audit_events": events}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
+)
+
+// authorize checks whether the current user may perform the action on the resource and
+// writes the error response if not. Handlers should return straight away when it
+// returns false. The resources are looked up by the ID the client gave, so a denial is
+// a 404 Not Found like a missing resource, which doesn't tell whether it exists.
+//
+// A request allowed by the policy file in "replace" mode (see EnforcePolicy) may act on
+// the resources of the current user, as if they held "<action>:own": the policy file
+// only matches the routes, so it can't tell whose records they lead to, and the
+// resources of other users still take the permissions.
+func (h Handlers) authorize(w http.ResponseWriter, r *http.Request, action string, resource policies.Resource) bool {
+	user := apicontext.ContextGetUser(r)
+
+	if apicontext.ContextPolicyAllowed(r) && (resource == nil || resource.OwnerID() == user.UserID) {
+		return true
+	}
+
+	r, permissions, err := h.policies.Permissions(r)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	if !h.policies.Can(user, permissions, action, resource) {
+		h.errors.NotFoundResponse(w, r)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name          string
+		policyAllowed bool
+		permissions   data.Permissions
+		own           bool
+		want          bool
+	}{
+		{name: "own record", own: true, want: false},
+		{name: "own record with the own permission", permissions: data.Permissions{"users:edit:own"}, own: true, want: true},
+		{name: "other record with the own permission", permissions: data.Permissions{"users:edit:own"}, want: false},
+		{name: "other record with the permission", permissions: data.Permissions{"users:edit"}, want: true},
+		{name: "own record allowed by the policy", policyAllowed: true, own: true, want: true},
+		{name: "other record allowed by the policy", policyAllowed: true, want: false},
+		{name: "other record allowed by the policy with the permission", policyAllowed: true, permissions: data.Permissions{"users:edit:any"}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestModels()
+			h := newTestHandlers(t, models)
+
+			user := insertTestUser(t, models, "alice@example.com", "alice")
+			resource := user
+			if !tt.own {
+				resource = insertTestUser(t, models, "bob@example.com", "bob")
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPatch, "/v1/users/"+resource.UserID.String(), nil)
+			r = apicontext.ContextSetUser(r, user)
+			r = apicontext.ContextSetPermissions(r, tt.permissions)
+			if tt.policyAllowed {
+				r = apicontext.ContextSetPolicyAllowed(r)
+			}
+
+			got := h.authorize(w, r, "users:edit", resource)
+			if got != tt.want {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+
+			if !got && w.Code != http.StatusNotFound {
+				t.Errorf("got status %d, want %d", w.Code, http.StatusNotFound)
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"sync"
 
 	apierrors "github.com/hasahmad/go-skeleton/internal/api/errors"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
 	"github.com/hasahmad/go-skeleton/internal/config"
 	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/hasahmad/go-skeleton/internal/mailer"
@@ -11,12 +12,13 @@ import (
 )
 
 type Handlers struct {
-	logger *logrus.Logger
-	cfg    config.Config
-	errors apierrors.ErrorResponses
-	mailer mailer.Mailer
-	models data.Models
-	wg     sync.WaitGroup
+	logger   *logrus.Logger
+	cfg      config.Config
+	errors   apierrors.ErrorResponses
+	mailer   mailer.Mailer
+	models   data.Models
+	policies policies.Policies
+	wg       *sync.WaitGroup
 }
 
 func New(
@@ -24,15 +26,17 @@ func New(
 	cfg config.Config,
 	errors apierrors.ErrorResponses,
 	models data.Models,
+	policies policies.Policies,
 	mailer mailer.Mailer,
-	wg sync.WaitGroup,
+	wg *sync.WaitGroup,
 ) Handlers {
 	return Handlers{
-		logger: logger,
-		cfg:    cfg,
-		errors: errors,
-		models: models,
-		mailer: mailer,
-		wg:     wg,
+		logger:   logger,
+		cfg:      cfg,
+		errors:   errors,
+		models:   models,
+		policies: policies,
+		mailer:   mailer,
+		wg:       wg,
 	}
 }
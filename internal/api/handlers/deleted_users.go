@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// deletedUser shows when the user was deleted, which is hidden for the other users.
+type deletedUser struct {
+	*data.User
+	DeletedAt data.NullTime `json:"deleted_at"`
+}
+
+// deletedUserFilters are the fields the deleted users can be filtered on.
+var deletedUserFilters = data.FilterSafelist{
+	"user_id":    {Type: data.FilterUUID, Operators: data.UUIDFilterOperators},
+	"email":      {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"deleted_at": {Type: data.FilterTime, Operators: data.TimeFilterOperators},
+}
+
+func (h Handlers) ListDeletedUsersHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+
+	qs := r.URL.Query()
+
+	where := data.ParseFilterQuery(v, qs, deletedUserFilters)
+
+	filters := h.readFilters(qs, v, "-deleted_at", []string{"deleted_at", "email", "-deleted_at", "-email"})
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	users, metadata, err := h.models.Users.GetAllDeleted(r.Context(), where, filters)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	setPageLinks(r, &metadata)
+
+	deleted := make([]deletedUser, len(users))
+	for i := range users {
+		deleted[i] = deletedUser{User: users[i], DeletedAt: users[i].RemovedAt}
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"metadata": metadata, "users": deleted}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) RestoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	var user *data.User
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Restore(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		user, err = h.models.Users.Get(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserRestore, data.AuditTargetUser, id.String(), nil, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v := validator.New()
+			v.AddError("email", "another user has taken this email address since the user was deleted")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v := validator.New()
+			v.AddError("username", "another user has taken this username since the user was deleted")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// PurgeUserHandler permanently removes a soft-deleted user. The audit events about the
+// user are kept.
+func (h Handlers) PurgeUserHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Purge(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserPurge, data.AuditTargetUser, id.String(), nil, nil)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "user successfully purged"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
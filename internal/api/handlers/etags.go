@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// versionETag returns the ETag of a resource at a version, the version column bumped by
+// each of its updates.
+func versionETag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// etagsMatch reports whether the value of an If-Match or If-None-Match header lists the
+// ETag or is "*". The weak ETags match only when weak is set, as If-Match compares them
+// strongly.
+func etagsMatch(header, etag string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if weak {
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkIfMatch checks the If-Match header of an update or delete against the ETag of
+// the resource, responding with 412 Precondition Failed when it doesn't match. Without
+// the header the request goes through, unless preconditions are required in which case
+// it responds with 428 Precondition Required.
+func (h Handlers) checkIfMatch(w http.ResponseWriter, r *http.Request, etag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if h.cfg.Preconditions.Required {
+			h.errors.PreconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	if !etagsMatch(header, etag, false) {
+		h.errors.PreconditionFailedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// notModified sets the ETag of the resource and, if the If-None-Match header of the
+// request lists it, responds with 304 Not Modified.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	if !etagsMatch(r.Header.Get("If-None-Match"), etag, true) {
+		return false
+	}
+
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+// exportTTL is how long an export, and the token to download it, are kept.
+const exportTTL = 24 * time.Hour
+
+// ExportUserDataHandler starts assembling an archive of the user's data. The archive is
+// built in the background and the user is emailed a token to download it.
+func (h Handlers) ExportUserDataHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.authorize(w, r, "users:export", user) {
+		return
+	}
+
+	export := &data.DataExport{UserID: user.UserID}
+
+	// committed on its own rather than with the request's transaction (see
+	// TenantTransaction), so the export exists by the time it is built in the background
+	err := h.models.Transaction(data.ContextWithoutTx(r.Context()), func(ctx context.Context) error {
+		err := h.models.Exports.Insert(ctx, export)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Insert(ctx, &data.AuditEvent{
+			Action:     data.AuditUserExport,
+			TargetType: data.AuditTargetUser,
+			TargetID:   user.UserID.String(),
+			Changes:    data.AuditChanges{"export_id": {After: export.ExportID}},
+		})
+	})
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// the request's context and transaction end with the response
+	ctx := data.ContextWithAuditSource(context.Background(), data.AuditSourceFromContext(r.Context()))
+
+	helpers.Background(h.logger, h.wg, func() {
+		token, err := h.completeExport(ctx, user, export)
+		if errors.Is(err, data.ErrRecordNotFound) {
+			// deleted meanwhile, with the user's data being erased
+			return
+		}
+		if err != nil {
+			h.logger.Error(err)
+
+			err = h.models.Exports.Fail(ctx, export)
+			if err != nil {
+				h.logger.Error(err)
+			}
+			return
+		}
+
+		data := map[string]interface{}{
+			"exportToken": token.Plaintext,
+		}
+		err = h.mailer.Send(user.Email, "data_export.tmpl", data)
+		if err != nil {
+			h.logger.Error(err)
+		}
+	})
+
+	err = helpers.WriteJSON(w, http.StatusAccepted, helpers.Envelope{"export": export}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// completeExport builds and stores the archive, and returns a new token to download it.
+// The tokens of previous exports are revoked.
+func (h Handlers) completeExport(ctx context.Context, user *data.User, export *data.DataExport) (*data.Token, error) {
+	content, err := h.buildExport(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	export.Content = content
+	export.ExpiresAt = null.TimeFrom(time.Now().Add(exportTTL))
+
+	var token *data.Token
+
+	err = h.models.Transaction(ctx, func(ctx context.Context) error {
+		err := h.models.Exports.Complete(ctx, export)
+		if err != nil {
+			return err
+		}
+
+		err = h.models.Tokens.DeleteAllForUser(ctx, data.ScopeExport, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		token, err = h.models.Tokens.New(ctx, user.UserID, exportTTL, data.ScopeExport)
+		return err
+	})
+
+	return token, err
+}
+
+// buildExport returns a ZIP archive with a JSON file for each kind of data stored about
+// the user.
+func (h Handlers) buildExport(ctx context.Context, user *data.User) ([]byte, error) {
+	roles, err := h.models.Roles.GetAccessForUser(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := h.models.Permissions.GetAccessForUser(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	orgs, err := h.models.Organizations.GetAllForUser(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := h.models.Tokens.GetAllForUser(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the token hashes are secret, only tell what they are for
+	type session struct {
+		Scope  string    `json:"scope"`
+		Expiry time.Time `json:"expiry"`
+	}
+
+	sessions := make([]session, len(tokens))
+	for i := range tokens {
+		sessions[i] = session{Scope: tokens[i].Scope, Expiry: tokens[i].Expiry}
+	}
+
+	logins := []*data.AuditEvent{}
+	events := []*data.AuditEvent{}
+
+	err = h.models.Audit.Each(ctx, []goqu.Expression{goqu.Or(
+		goqu.Ex{"actor_id": user.UserID},
+		goqu.Ex{"target_type": data.AuditTargetUser, "target_id": user.UserID.String()},
+	)}, func(event *data.AuditEvent) error {
+		switch event.Action {
+		case data.AuditLogin, data.AuditLoginFailed:
+			logins = append(logins, event)
+		default:
+			events = append(events, event)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content interface{}
+	}{
+		{"profile.json", user},
+		{"roles.json", roles},
+		{"permissions.json", permissions},
+		{"organizations.json", orgs},
+		{"sessions.json", sessions},
+		{"login_history.json", logins},
+		{"audit_events.json", events},
+	}
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, file := range files {
+		f, err := zw.Create(file.name)
+		if err != nil {
+			return nil, err
+		}
+
+		enc := json.NewEncoder(f)
+		enc.SetIndent("", "\t")
+
+		err = enc.Encode(file.content)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.name, err)
+		}
+	}
+
+	err = zw.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// DownloadUserExportHandler sends the latest export of the user owning the token.
+func (h Handlers) DownloadUserExportHandler(w http.ResponseWriter, r *http.Request) {
+	tokenPlaintext, _ := helpers.ReadString(r.URL.Query(), "token", "")
+
+	v := validator.New()
+
+	if data.ValidateTokenPlaintext(v, tokenPlaintext); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.models.Users.GetForToken(r.Context(), data.ScopeExport, tokenPlaintext)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired export token")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	export, err := h.models.Exports.GetLatestForUser(r.Context(), user.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.zip"`, export.CreatedAt.UTC().Format("20060102150405")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	w.Write(export.Content)
+}
+
+// EraseUserHandler anonymizes the personal data of the user and logs them out. The user
+// record is kept so what refers to it, the audit log in particular, stays intact.
+func (h Handlers) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !h.authorize(w, r, "users:erase", user) {
+		return
+	}
+
+	v := validator.New()
+	v.Check(!user.IsSuperuser, "user", "superusers cannot be erased")
+	v.Check(!user.ErasedAt.Valid, "user", "has already been erased")
+
+	if !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Erase(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		err = h.models.Tokens.RevokeAllForUser(ctx, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		err = h.models.Exports.DeleteAllForUser(ctx, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		// a diff would copy the erased data into the audit log
+		return h.models.Audit.Insert(ctx, &data.AuditEvent{
+			Action:     data.AuditUserErase,
+			TargetType: data.AuditTargetUser,
+			TargetID:   user.UserID.String(),
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "user data successfully erased"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// relation loads the related data of a record, which a client can embed in it with the
+// include parameter.
+type relation func(ctx context.Context, record interface{}) (interface{}, error)
+
+// fieldset is the fields of the records a client asked for, and the relations to embed
+// in them.
+type fieldset struct {
+	fields    []string
+	include   []string
+	relations map[string]relation
+}
+
+// readFieldset reads the fields (the fields of the records to return, all of them by
+// default) and include (the relations to embed in the records) parameters, both comma
+// separated lists checked against the safelist and the relations.
+func readFieldset(qs url.Values, v *validator.Validator, fieldSafelist []string, relations map[string]relation) fieldset {
+	fs := fieldset{relations: relations}
+	fs.fields, _ = helpers.ReadCSV(qs, "fields", nil)
+	fs.include, _ = helpers.ReadCSV(qs, "include", nil)
+
+	for _, field := range fs.fields {
+		v.Check(validator.In(field, fieldSafelist...), "fields", "unknown field "+field)
+	}
+	v.Check(validator.Unique(fs.fields), "fields", "must not contain duplicate values")
+
+	for _, name := range fs.include {
+		_, ok := relations[name]
+		v.Check(ok, "include", "unknown relation "+name)
+	}
+	v.Check(validator.Unique(fs.include), "include", "must not contain duplicate values")
+
+	return fs
+}
+
+// shape returns the record with only the fields of the fieldset, and with the relations
+// it includes. The record is returned as is when the fieldset is empty.
+func (fs fieldset) shape(ctx context.Context, record interface{}) (interface{}, error) {
+	if len(fs.fields) == 0 && len(fs.include) == 0 {
+		return record, nil
+	}
+
+	js, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	err = json.Unmarshal(js, &all)
+	if err != nil {
+		return nil, err
+	}
+
+	shaped := map[string]interface{}{}
+	for field, value := range all {
+		if len(fs.fields) == 0 || validator.In(field, fs.fields...) {
+			shaped[field] = value
+		}
+	}
+
+	for _, name := range fs.include {
+		shaped[name], err = fs.relations[name](ctx, record)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return shaped, nil
+}
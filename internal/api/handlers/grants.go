@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"github.com/julienschmidt/httprouter"
+	"gopkg.in/guregu/null.v4"
+)
+
+// GrantUserAccessHandler grants roles and permissions directly to a user, optionally
+// only for a period of time.
+func (h Handlers) GrantUserAccessHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Roles       []string   `json:"roles"`
+		Permissions []string   `json:"permissions"`
+		ValidFrom   *time.Time `json:"valid_from"`
+		ValidUntil  null.Time  `json:"valid_until"`
+		Reason      string     `json:"reason"`
+	}
+
+	err = helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	grant := data.Grant{
+		ValidUntil: input.ValidUntil,
+		Reason:     input.Reason,
+	}
+	if input.ValidFrom != nil {
+		grant.ValidFrom = *input.ValidFrom
+	}
+
+	v := validator.New()
+	v.Check(len(input.Roles)+len(input.Permissions) > 0, "roles", "must contain at least 1 role or permission")
+	v.Check(validator.Unique(input.Roles), "roles", "must not contain duplicate values")
+	v.Check(validator.Unique(input.Permissions), "permissions", "must not contain duplicate values")
+
+	if data.ValidateGrant(v, grant); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := h.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		if len(input.Roles) > 0 {
+			err := h.models.Roles.GrantForUser(ctx, user.UserID, grant, input.Roles...)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(input.Permissions) > 0 {
+			err := h.models.Permissions.GrantForUser(ctx, user.UserID, grant, input.Permissions...)
+			if err != nil {
+				return err
+			}
+		}
+
+		return h.models.Audit.Insert(ctx, &data.AuditEvent{
+			Action:     data.AuditUserGrant,
+			TargetType: data.AuditTargetUser,
+			TargetID:   user.UserID.String(),
+			Changes: data.AuditChanges{
+				"roles":       {After: input.Roles},
+				"permissions": {After: input.Permissions},
+				"valid_from":  {After: input.ValidFrom},
+				"valid_until": {After: input.ValidUntil},
+				"reason":      {After: input.Reason},
+			},
+		})
+	})
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	roles, err := h.models.Roles.GetAccessForUser(r.Context(), user.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := h.models.Permissions.GetAccessForUser(r.Context(), user.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{
+		"user_id":     user.UserID,
+		"roles":       roles,
+		"permissions": permissions,
+	}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// RevokeUserRoleHandler removes a role granted directly to a user.
+func (h Handlers) RevokeUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Roles.RevokeForUser(ctx, id, code)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Insert(ctx, &data.AuditEvent{
+			Action:     data.AuditUserRevoke,
+			TargetType: data.AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    data.AuditChanges{"role": {Before: code}},
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "role successfully revoked"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// RevokeUserPermissionHandler removes a permission granted directly to a user.
+func (h Handlers) RevokeUserPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	code := httprouter.ParamsFromContext(r.Context()).ByName("code")
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Permissions.RevokeForUser(ctx, id, code)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Insert(ctx, &data.AuditEvent{
+			Action:     data.AuditUserRevoke,
+			TargetType: data.AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    data.AuditChanges{"permission": {Before: code}},
+		})
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "permission successfully revoked"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,371 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+func (h Handlers) ListGroupsHandler(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.models.Groups.GetAll(r.Context())
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"groups": groups}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) CreateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name        string   `json:"name"`
+		Roles       []string `json:"roles"`
+		Permissions []string `json:"permissions"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	group := &data.Group{
+		Name:        input.Name,
+		Roles:       input.Roles,
+		Permissions: input.Permissions,
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if !h.checkGroupAccess(w, r, group) {
+		return
+	}
+
+	err = h.models.Groups.Insert(r.Context(), group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGroupName):
+			v.AddError("name", "a group with this name already exists")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	// reload the roles and permissions as stored
+	group, err = h.models.Groups.Get(r.Context(), group.GroupID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"group": group}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) ShowGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := h.models.Groups.GetMemberIDs(r.Context(), group.GroupID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"group": group, "members": members}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) UpdateGroupHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	// roles and permissions are replaced when provided
+	var input struct {
+		Name        string    `json:"name"`
+		Roles       *[]string `json:"roles"`
+		Permissions *[]string `json:"permissions"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != "" {
+		group.Name = input.Name
+	}
+	if input.Roles != nil {
+		group.Roles = *input.Roles
+	}
+	if input.Permissions != nil {
+		group.Permissions = *input.Permissions
+	}
+
+	v := validator.New()
+
+	if data.ValidateGroup(v, group); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if (input.Roles != nil || input.Permissions != nil) && !h.checkGroupAccess(w, r, group) {
+		return
+	}
+
+	err = h.models.Groups.Update(r.Context(), group)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrDuplicateGroupName):
+			v.AddError("name", "a group with this name already exists")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if input.Roles != nil || input.Permissions != nil {
+		err = h.models.Groups.SetAccess(r.Context(), group.GroupID, group.Roles, group.Permissions)
+		if err != nil {
+			h.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	group, err = h.models.Groups.Get(r.Context(), group.GroupID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"group": group}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) DeleteGroupHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	err = h.models.Groups.Delete(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "group successfully deleted"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) AddGroupMembersHandler(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.readGroup(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		UserIDs []uuid.UUID `json:"user_ids"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.UserIDs) > 0, "user_ids", "must contain at least 1 user")
+
+	if !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.models.Groups.AddMembers(r.Context(), group.GroupID, input.UserIDs...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_ids", "must only contain existing users")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	members, err := h.models.Groups.GetMemberIDs(r.Context(), group.GroupID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"group": group, "members": members}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) RemoveGroupMemberHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	userID, err := helpers.ReadUUIDParamByKey(r, "user_id")
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	err = h.models.Groups.RemoveMembers(r.Context(), id, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readGroup loads the group from the :id route parameter, writing the error response
+// and returning false if that isn't possible.
+func (h Handlers) readGroup(w http.ResponseWriter, r *http.Request) (*data.Group, bool) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return nil, false
+	}
+
+	group, err := h.models.Groups.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return group, true
+}
+
+// checkGroupAccess checks the roles and permissions of the group, writing the error
+// response and returning false if they don't pass: unknown codes are a 422 naming them,
+// and granting a permission the current user doesn't hold themselves, directly or
+// through one of the roles, is a 403. Otherwise anyone managing the groups could
+// grant themselves everything through a group.
+func (h Handlers) checkGroupAccess(w http.ResponseWriter, r *http.Request, group *data.Group) bool {
+	roles, err := h.models.Roles.GetAllByCode(r.Context(), group.Roles...)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	permissions, err := h.models.Permissions.GetAllByCode(r.Context(), group.Permissions...)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	v := validator.New()
+
+	if unknown := unknownCodes(group.Roles, roles); len(unknown) > 0 {
+		v.AddError("roles", "unknown roles: "+strings.Join(unknown, ", "))
+	}
+	if unknown := unknownCodes(group.Permissions, permissions); len(unknown) > 0 {
+		v.AddError("permissions", "unknown permissions: "+strings.Join(unknown, ", "))
+	}
+
+	if !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return false
+	}
+
+	if apicontext.ContextGetUser(r).IsSuperuser {
+		return true
+	}
+
+	granted, err := h.models.Permissions.GetAllForRoles(r.Context(), group.Roles...)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	r, held, err := h.policies.Permissions(r)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return false
+	}
+
+	if !held.IncludeMultiple(append(granted, group.Permissions...), false) {
+		h.errors.NotPermittedResponse(w, r)
+		return false
+	}
+
+	return true
+}
+
+// unknownCodes returns the codes which aren't among the known ones.
+func unknownCodes(codes, known []string) []string {
+	isKnown := make(map[string]bool, len(known))
+	for _, code := range known {
+		isKnown[code] = true
+	}
+
+	var unknown []string
+	for _, code := range codes {
+		if !isKnown[code] {
+			unknown = append(unknown, code)
+		}
+	}
+
+	return unknown
+}
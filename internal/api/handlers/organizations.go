@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+func (h Handlers) CreateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	org := &data.Organization{Name: input.Name}
+
+	v := validator.New()
+
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.models.Organizations.Insert(r.Context(), org)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	// the creator owns the organization
+	user := apicontext.ContextGetUser(r)
+	err = h.models.Organizations.AddMember(r.Context(), org.OrganizationID, user.UserID, "owner")
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"organization": org}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) ListOrganizationsHandler(w http.ResponseWriter, r *http.Request) {
+	user := apicontext.ContextGetUser(r)
+
+	orgs, err := h.models.Organizations.GetAllForUser(r.Context(), user.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"organizations": orgs}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) ShowOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	tenant := apicontext.ContextGetTenant(r)
+
+	err := helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{
+		"organization": tenant.Organization,
+		"membership":   tenant.Membership,
+	}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) UpdateOrganizationHandler(w http.ResponseWriter, r *http.Request) {
+	org := apicontext.ContextGetTenant(r).Organization
+
+	var input struct {
+		Name string `json:"name"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != "" {
+		org.Name = input.Name
+	}
+
+	v := validator.New()
+
+	if data.ValidateOrganization(v, org); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.models.Organizations.Update(r.Context(), org)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"organization": org}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) ListOrganizationMembersHandler(w http.ResponseWriter, r *http.Request) {
+	org := apicontext.ContextGetTenant(r).Organization
+
+	members, err := h.models.Organizations.GetMembers(r.Context(), org.OrganizationID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"members": members}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) AddOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org := apicontext.ContextGetTenant(r).Organization
+
+	var input struct {
+		UserID uuid.UUID `json:"user_id"`
+		Roles  []string  `json:"roles"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	if len(input.Roles) == 0 {
+		input.Roles = []string{"member"}
+	}
+
+	v := validator.New()
+	v.Check(input.UserID != uuid.Nil, "user_id", "must be provided")
+
+	if data.ValidateMemberRoles(v, input.Roles); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = h.models.Organizations.AddMember(r.Context(), org.OrganizationID, input.UserID, input.Roles...)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			v.AddError("user_id", "user does not exist")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	membership, err := h.models.Organizations.GetMembership(r.Context(), org.OrganizationID, input.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusCreated, helpers.Envelope{"member": membership}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+func (h Handlers) RemoveOrganizationMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org := apicontext.ContextGetTenant(r).Organization
+
+	userID, err := helpers.ReadUUIDParamByKey(r, "user_id")
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	err = h.models.Organizations.RemoveMember(r.Context(), org.OrganizationID, userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"message": "member successfully removed"}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// readFilters reads the pagination and sort parameters of a list endpoint: page,
+// page_size, sort, cursor (which replaces page) and count (false to skip counting the
+// records).
+func (h Handlers) readFilters(qs url.Values, v *validator.Validator, defaultSort string, sortSafelist []string) data.Filters {
+	var filters data.Filters
+	filters.Page, _ = helpers.ReadInt(qs, "page", 1, v)
+	filters.PageSize, _ = helpers.ReadInt(qs, "page_size", 20, v)
+	filters.Sort, _ = helpers.ReadString(qs, "sort", defaultSort)
+	filters.SortSafelist = sortSafelist
+	filters.Cursor, _ = helpers.ReadString(qs, "cursor", "")
+	filters.CursorKey = []byte(h.cfg.Pagination.CursorSecret)
+
+	count, _ := helpers.ReadBool(qs, "count", true)
+	filters.SkipCount = !count
+
+	return filters
+}
+
+// setPageLinks sets the links to the next and previous pages, which are the request's
+// URL with the cursor of the page in place of the page number.
+func setPageLinks(r *http.Request, metadata *data.Metadata) {
+	link := func(cursor string) string {
+		if cursor == "" {
+			return ""
+		}
+
+		qs := r.URL.Query()
+		qs.Del("page")
+		qs.Set("cursor", cursor)
+
+		u := url.URL{Path: r.URL.Path, RawQuery: qs.Encode()}
+		return u.String()
+	}
+
+	metadata.Next = link(metadata.NextCursor)
+	metadata.Prev = link(metadata.PrevCursor)
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+// SuspendUserHandler suspends a user, until the given time or indefinitely, and
+// revokes their authentication tokens.
+func (h Handlers) SuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	// only a superuser may suspend another one
+	currentUser := apicontext.ContextGetUser(r)
+	if user.IsSuperuser && !currentUser.IsSuperuser {
+		h.errors.NotPermittedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Reason string    `json:"reason"`
+		Until  null.Time `json:"until"`
+	}
+
+	err := helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	suspension := data.Suspension{
+		SuspendedAt:      null.TimeFrom(time.Now()),
+		SuspendedUntil:   input.Until,
+		SuspensionReason: input.Reason,
+		SuspendedBy:      uuid.NullUUID{UUID: currentUser.UserID, Valid: true},
+	}
+
+	v := validator.New()
+	v.Check(currentUser.UserID != user.UserID, "user", "you cannot suspend yourself")
+
+	if data.ValidateSuspension(v, suspension); !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	before := *user
+	user.Suspension = suspension
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.SetSuspension(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		err = h.models.Tokens.DeleteAllForUser(ctx, data.ScopeAuthentication, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserSuspend, data.AuditTargetUser, user.UserID.String(), &before, user)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// UnsuspendUserHandler lifts the suspension of a user. Their old tokens stay revoked.
+func (h Handlers) UnsuspendUserHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.readUser(w, r)
+	if !ok {
+		return
+	}
+
+	if !user.SuspendedAt.Valid {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	before := *user
+	user.Suspension = data.Suspension{}
+
+	err := h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.SetSuspension(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserUnsuspend, data.AuditTargetUser, user.UserID.String(), &before, user)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestSuspendUserHandler(t *testing.T) {
+	tests := []struct {
+		name          string
+		self          bool
+		superuser     bool
+		callerIsSuper bool
+		wantCode      int
+	}{
+		{name: "user", wantCode: http.StatusOK},
+		{name: "yourself", self: true, wantCode: http.StatusUnprocessableEntity},
+		{name: "superuser", superuser: true, wantCode: http.StatusForbidden},
+		{name: "superuser by a superuser", superuser: true, callerIsSuper: true, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestModels()
+			h := newTestHandlers(t, models)
+
+			caller := insertTestUser(t, models, "alice@example.com", "alice")
+			caller.IsSuperuser = tt.callerIsSuper
+
+			user := caller
+			if !tt.self {
+				user = insertTestUser(t, models, "bob@example.com", "bob")
+				user.IsSuperuser = tt.superuser
+
+				err := models.Users.Update(context.Background(), user)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			_, err := models.Tokens.New(context.Background(), user.UserID, time.Hour, data.ScopeAuthentication)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/users/"+user.UserID.String()+"/suspension", strings.NewReader(`{"reason": "spam"}`))
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: user.UserID.String()}}))
+			r = apicontext.ContextSetUser(r, caller)
+			r = apicontext.ContextSetPolicyAllowed(r)
+
+			h.SuspendUserHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			stored, err := models.Users.Get(context.Background(), user.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.IsSuspended() != (tt.wantCode == http.StatusOK) {
+				t.Errorf("got suspended %v after status %d", stored.IsSuspended(), w.Code)
+			}
+		})
+	}
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/hasahmad/go-skeleton/internal/api/helpers"
@@ -11,7 +13,9 @@ import (
 )
 
 func (h Handlers) CreateAuthenticationTokenHandler(w http.ResponseWriter, r *http.Request) {
+	// login is the username or the email address, email is still accepted on its own
 	var input struct {
+		Login    string `json:"login"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
 	}
@@ -22,8 +26,13 @@ func (h Handlers) CreateAuthenticationTokenHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if input.Login == "" {
+		input.Login = input.Email
+	}
+
 	v := validator.New()
-	data.ValidateEmail(v, input.Email)
+	v.Check(input.Login != "", "login", "must be provided")
+	v.Check(len(input.Login) <= 254, "login", "must not be more than 254 bytes long")
 	data.ValidatePasswordPlaintext(v, input.Password)
 
 	if !v.Valid() {
@@ -31,7 +40,13 @@ func (h Handlers) CreateAuthenticationTokenHandler(w http.ResponseWriter, r *htt
 		return
 	}
 
-	user, err := h.models.Users.GetByEmail(r.Context(), input.Email)
+	// usernames can't contain "@"
+	var user *data.User
+	if strings.Contains(input.Login, "@") {
+		user, err = h.models.Users.GetByEmail(r.Context(), input.Login)
+	} else {
+		user, err = h.models.Users.GetByUsername(r.Context(), input.Login)
+	}
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -43,6 +58,13 @@ func (h Handlers) CreateAuthenticationTokenHandler(w http.ResponseWriter, r *htt
 		}
 	}
 
+	// the erased users can't log in anymore, and the others must activate their
+	// account first
+	if user.ErasedAt.Valid || !user.IsActive {
+		h.errors.InvalidCredentialsResponse(w, r)
+		return
+	}
+
 	match, err := user.Password.Matches(input.Password)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
@@ -50,11 +72,48 @@ func (h Handlers) CreateAuthenticationTokenHandler(w http.ResponseWriter, r *htt
 	}
 
 	if !match {
+		// kept even if the request's transaction is rolled back
+		err = h.models.Audit.Record(data.ContextWithoutTx(r.Context()), data.AuditLoginFailed, data.AuditTargetUser, user.UserID.String(), nil, nil)
+		if err != nil {
+			h.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+
 		h.errors.InvalidCredentialsResponse(w, r)
 		return
 	}
 
-	token, err := h.models.Tokens.New(r.Context(), user.UserID, 24*time.Hour, data.ScopeAuthentication)
+	// checked after the password so the suspension isn't disclosed to whoever doesn't
+	// know it, who get the same response as for a wrong password
+	if user.IsSuspended() {
+		err = h.models.Audit.Insert(data.ContextWithoutTx(r.Context()), &data.AuditEvent{
+			Action:     data.AuditLoginFailed,
+			TargetType: data.AuditTargetUser,
+			TargetID:   user.UserID.String(),
+			Changes:    data.AuditChanges{"reason": {After: "suspended"}},
+		})
+		if err != nil {
+			h.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		h.errors.AccountSuspendedResponse(w, r)
+		return
+	}
+
+	var token *data.Token
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		ctx = data.ContextWithAuditActor(ctx, user.UserID)
+
+		err := h.models.Audit.Record(ctx, data.AuditLogin, data.AuditTargetUser, user.UserID.String(), nil, nil)
+		if err != nil {
+			return err
+		}
+
+		token, err = h.models.Tokens.New(ctx, user.UserID, 24*time.Hour, data.ScopeAuthentication)
+		return err
+	})
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
 		return
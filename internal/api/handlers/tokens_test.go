@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestCreateAuthenticationTokenHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(t *testing.T, h Handlers, login string)
+		login    string
+		password string
+		wantCode int
+	}{
+		{
+			name:     "by email",
+			login:    "alice@example.com",
+			password: "pa55word1234",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "by email in another case",
+			login:    "Alice@Example.com",
+			password: "pa55word1234",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "by username",
+			login:    "alice",
+			password: "pa55word1234",
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "wrong password",
+			login:    "alice",
+			password: "wrongpa55word",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown user",
+			login:    "bob",
+			password: "pa55word1234",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "inactive user",
+			setup: func(t *testing.T, h Handlers, login string) {
+				user, err := h.models.Users.GetByUsername(context.Background(), login)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				user.IsActive = false
+				err = h.models.Users.Update(context.Background(), user)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			login:    "alice",
+			password: "pa55word1234",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name: "erased user",
+			setup: func(t *testing.T, h Handlers, login string) {
+				user, err := h.models.Users.GetByUsername(context.Background(), login)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				err = h.models.Users.Erase(context.Background(), user)
+				if err != nil {
+					t.Fatal(err)
+				}
+			},
+			login:    "alice",
+			password: "pa55word1234",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "suspended user",
+			setup:    suspendTestUser,
+			login:    "alice",
+			password: "pa55word1234",
+			wantCode: http.StatusForbidden,
+		},
+		{
+			// the suspension is only disclosed to whoever knows the password
+			name:     "suspended user with a wrong password",
+			setup:    suspendTestUser,
+			login:    "alice",
+			password: "wrongpa55word",
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestModels()
+			h := newTestHandlers(t, models)
+			user := insertTestUser(t, models, "alice@example.com", "alice")
+
+			login := tt.login
+			if tt.setup != nil {
+				tt.setup(t, h, login)
+
+				// the erased users are only found by their placeholder
+				stored, err := models.Users.Get(context.Background(), user.UserID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				login = stored.Username.String
+			}
+
+			body := `{"login": "` + login + `", "password": "` + tt.password + `"}`
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/tokens/authentication", strings.NewReader(body))
+
+			h.CreateAuthenticationTokenHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+		})
+	}
+}
+
+func suspendTestUser(t *testing.T, h Handlers, login string) {
+	t.Helper()
+
+	user, err := h.models.Users.GetByUsername(context.Background(), login)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	user.Suspension = data.Suspension{SuspendedAt: null.TimeFrom(time.Now())}
+	err = h.models.Users.SetSuspension(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
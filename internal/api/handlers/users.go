@@ -1,14 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"net/http"
 	"time"
 
-	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
 	"github.com/hasahmad/go-skeleton/internal/api/helpers"
 	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/hasahmad/go-skeleton/internal/validator"
+	"github.com/julienschmidt/httprouter"
 	"gopkg.in/guregu/null.v4"
 )
 
@@ -50,31 +53,46 @@ func (h Handlers) RegisterUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.models.Users.Insert(r.Context(), user)
+	var token *data.Token
+
+	// the user is only created along with their role and activation token
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Insert(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		// the new user is the actor of their registration
+		ctx = data.ContextWithAuditActor(ctx, user.UserID)
+
+		err = h.models.Audit.Record(ctx, data.AuditUserRegister, data.AuditTargetUser, user.UserID.String(), nil, user)
+		if err != nil {
+			return err
+		}
+
+		// add initial user role once registered
+		err = h.models.Roles.AddForUser(ctx, user.UserID, "user")
+		if err != nil {
+			return err
+		}
+
+		token, err = h.models.Tokens.New(ctx, user.UserID, 3*24*time.Hour, data.ScopeActivation)
+		return err
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrDuplicateEmail):
 			v.AddError("email", "a user with this email address already exists")
 			h.errors.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v.AddError("username", "a user with this username already exists")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
 		default:
 			h.errors.ServerErrorResponse(w, r, err)
 		}
 		return
 	}
 
-	// add initial user role once registered
-	err = h.models.Roles.AddForUser(r.Context(), user.UserID, "user")
-	if err != nil {
-		h.errors.ServerErrorResponse(w, r, err)
-		return
-	}
-
-	token, err := h.models.Tokens.New(r.Context(), user.UserID, 3*24*time.Hour, data.ScopeActivation)
-	if err != nil {
-		h.errors.ServerErrorResponse(w, r, err)
-		return
-	}
-
 	// Send the welcome email in the background
 	helpers.Background(h.logger, h.wg, func() {
 		data := map[string]interface{}{
@@ -124,8 +142,26 @@ func (h Handlers) ActivateUserHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	before := *user
 	user.IsActive = true
-	err = h.models.Users.Update(r.Context(), user)
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Update(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		ctx = data.ContextWithAuditActor(ctx, user.UserID)
+
+		err = h.models.Audit.Record(ctx, data.AuditUserActivate, data.AuditTargetUser, user.UserID.String(), &before, user)
+		if err != nil {
+			return err
+		}
+
+		// If everything went successfully, then we delete all activation tokens for the
+		// user.
+		return h.models.Tokens.DeleteAllForUser(ctx, data.ScopeActivation, user.UserID)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrEditConflict):
@@ -136,17 +172,35 @@ func (h Handlers) ActivateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// If everything went successfully, then we delete all activation tokens for the
-	// user.
-	err = h.models.Tokens.DeleteAllForUser(r.Context(), data.ScopeActivation, user.UserID)
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
-		return
 	}
+}
 
-	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
-	if err != nil {
-		h.errors.ServerErrorResponse(w, r, err)
+// userFields are the fields of a user a client can ask for, and userListFields those of
+// the users of a listing (see data.UserListColumns).
+var (
+	userFields = []string{
+		"user_id", "created_at", "updated_at", "first_name", "last_name", "username", "email",
+		"is_active", "is_staff", "is_superuser", "last_login", "erased_at",
+		"suspended_at", "suspended_until", "suspension_reason", "suspended_by",
+	}
+	userListFields = []string{
+		"user_id", "created_at", "updated_at", "first_name", "last_name", "username", "email",
+		"is_active", "is_staff", "is_superuser", "rank",
+	}
+)
+
+// userRelations are what can be embedded in a user with include.
+func (h Handlers) userRelations() map[string]relation {
+	return map[string]relation{
+		"roles": func(ctx context.Context, record interface{}) (interface{}, error) {
+			return h.models.Roles.GetAllForUser(ctx, record.(*data.User).UserID)
+		},
+		"permissions": func(ctx context.Context, record interface{}) (interface{}, error) {
+			return h.models.Permissions.GetAllForUser(ctx, record.(*data.User).UserID)
+		},
 	}
 }
 
@@ -157,6 +211,14 @@ func (h Handlers) ShowUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	v := validator.New()
+
+	fs := readFieldset(r.URL.Query(), v, userFields, h.userRelations())
+	if !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
 	user, err := h.models.Users.Get(r.Context(), id)
 	if err != nil {
 		switch {
@@ -168,64 +230,91 @@ func (h Handlers) ShowUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	if !h.authorize(w, r, "users:show", user) {
+		return
+	}
+
+	// the relations aren't versioned, so the ETag only covers the user
+	if len(fs.include) == 0 && notModified(w, r, versionETag(user.Version)) {
+		return
+	}
+
+	shaped, err := fs.shape(r.Context(), user)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
+		return
 	}
-}
 
-func (h Handlers) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
-	var input struct {
-		Username  string
-		Email     string
-		FirstName string
-		LastName  string
-		data.Filters
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": shaped}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
 	}
+}
+
+// userFilters are the fields the users can be filtered on.
+var userFilters = data.FilterSafelist{
+	"user_id":      {Type: data.FilterUUID, Operators: data.UUIDFilterOperators},
+	"email":        {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"username":     {Type: data.FilterString, Operators: append([]string{data.FilterIsNull}, data.StringFilterOperators...)},
+	"first_name":   {Type: data.FilterString, Operators: data.StringFilterOperators},
+	"last_name":    {Type: data.FilterString, Operators: append([]string{data.FilterIsNull}, data.StringFilterOperators...)},
+	"is_active":    {Type: data.FilterBool, Operators: data.BoolFilterOperators},
+	"is_staff":     {Type: data.FilterBool, Operators: data.BoolFilterOperators},
+	"is_superuser": {Type: data.FilterBool, Operators: data.BoolFilterOperators},
+	"created_at":   {Type: data.FilterTime, Operators: data.TimeFilterOperators},
+	"updated_at":   {Type: data.FilterTime, Operators: data.TimeFilterOperators},
+	"last_login":   {Type: data.FilterTime, Operators: append([]string{data.FilterIsNull}, data.TimeFilterOperators...)},
+}
 
+func (h Handlers) ListUsersHandler(w http.ResponseWriter, r *http.Request) {
 	v := validator.New()
 
 	qs := r.URL.Query()
 
-	input.FirstName, _ = helpers.ReadString(qs, "first_name", "")
-	input.LastName, _ = helpers.ReadString(qs, "last_name", "")
-	input.Username, _ = helpers.ReadString(qs, "username", "")
-	input.Email, _ = helpers.ReadString(qs, "email", "")
+	where := data.ParseFilterQuery(v, qs, userFilters)
 
-	input.Filters.Page, _ = helpers.ReadInt(qs, "page", 1, v)
-	input.Filters.PageSize, _ = helpers.ReadInt(qs, "page_size", 20, v)
-	input.Filters.Sort, _ = helpers.ReadString(qs, "sort", "user_id")
-	input.Filters.SortSafelist = []string{
-		"user_id", "username", "email", "first_name", "last_name",
-		"-user_id", "-username", "-email", "-first_name", "-last_name",
+	// the search results come by relevance unless sorted otherwise
+	search, _ := helpers.ReadString(qs, "q", "")
+	defaultSort := "user_id"
+	if search != "" {
+		defaultSort = "-rank"
 	}
 
-	if data.ValidateFilters(v, input.Filters); !v.Valid() {
+	filters := h.readFilters(qs, v, defaultSort, []string{
+		"user_id", "username", "email", "first_name", "last_name", "created_at",
+		"-user_id", "-username", "-email", "-first_name", "-last_name", "-created_at", "-rank",
+	})
+	filters.Search = search
+
+	fs := readFieldset(qs, v, userListFields, h.userRelations())
+	filters.Fields = fs.fields
+
+	v.Check(len(search) <= 200, "q", "must not be more than 200 bytes long")
+	v.Check(search != "" || !filters.SortsBy("rank"), "sort", "-rank requires a search")
+
+	if data.ValidateFilters(v, filters); !v.Valid() {
 		h.errors.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	where := []goqu.Expression{}
-	if input.FirstName != "" {
-		where = append(where, goqu.Ex{"first_name": input.FirstName})
-	}
-	if input.LastName != "" {
-		where = append(where, goqu.Ex{"last_name": input.FirstName})
-	}
-	if input.Username != "" {
-		where = append(where, goqu.Ex{"username": input.Username})
-	}
-	if input.Email != "" {
-		where = append(where, goqu.Ex{"email": input.Email})
-	}
-
-	users, metadata, err := h.models.Users.GetAll(r.Context(), where, input.Filters)
+	users, metadata, err := h.models.Users.GetAll(r.Context(), where, filters)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
 		return
 	}
 
-	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"metadata": metadata, "users": users}, nil)
+	setPageLinks(r, &metadata)
+
+	shaped := make([]interface{}, len(users))
+	for i, user := range users {
+		shaped[i], err = fs.shape(r.Context(), user)
+		if err != nil {
+			h.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"metadata": metadata, "users": shaped}, nil)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
 	}
@@ -249,6 +338,14 @@ func (h Handlers) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.authorize(w, r, "users:edit", user) {
+		return
+	}
+
+	if !h.checkIfMatch(w, r, versionETag(user.Version)) {
+		return
+	}
+
 	var input struct {
 		FirstName string `json:"first_name"`
 		LastName  string `json:"last_name"`
@@ -262,6 +359,8 @@ func (h Handlers) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	before := *user
+
 	if input.FirstName != "" {
 		user.FirstName = input.FirstName
 	}
@@ -277,14 +376,32 @@ func (h Handlers) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 
 	v := validator.New()
 
-	if data.ValidateEmail(v, input.Email); !v.Valid() {
+	data.ValidateEmail(v, input.Email)
+	if input.Username != "" {
+		data.ValidateUsername(v, input.Username)
+	}
+
+	if !v.Valid() {
 		h.errors.FailedValidationResponse(w, r, v.Errors)
 		return
 	}
 
-	err = h.models.Users.Update(r.Context(), user)
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Update(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserUpdate, data.AuditTargetUser, user.UserID.String(), &before, user)
+	})
 	if err != nil {
 		switch {
+		case errors.Is(err, data.ErrDuplicateEmail):
+			v.AddError("email", "a user with this email address already exists")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
+		case errors.Is(err, data.ErrDuplicateUsername):
+			v.AddError("username", "a user with this username already exists")
+			h.errors.FailedValidationResponse(w, r, v.Errors)
 		case errors.Is(err, data.ErrEditConflict):
 			h.errors.EditConflictResponse(w, r)
 		default:
@@ -293,7 +410,10 @@ func (h Handlers) UpdateUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(user.Version))
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, headers)
 	if err != nil {
 		h.errors.ServerErrorResponse(w, r, err)
 	}
@@ -306,7 +426,33 @@ func (h Handlers) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.models.Users.Delete(r.Context(), id)
+	user, err := h.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !h.authorize(w, r, "users:delete", user) {
+		return
+	}
+
+	if !h.checkIfMatch(w, r, versionETag(user.Version)) {
+		return
+	}
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Delete(ctx, user.UserID)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserDelete, data.AuditTargetUser, user.UserID.String(), user, nil)
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, data.ErrRecordNotFound):
@@ -322,3 +468,173 @@ func (h Handlers) DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
 		h.errors.ServerErrorResponse(w, r, err)
 	}
 }
+
+func (h Handlers) UpdateUserFlagsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := h.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !h.checkIfMatch(w, r, versionETag(user.Version)) {
+		return
+	}
+
+	// pointers so we can tell "not provided" apart from false
+	var input struct {
+		IsStaff     *bool `json:"is_staff"`
+		IsSuperuser *bool `json:"is_superuser"`
+	}
+
+	err = helpers.ReadJSON(w, r, &input)
+	if err != nil {
+		h.errors.BadRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(input.IsStaff != nil || input.IsSuperuser != nil, "flags", "must provide is_staff or is_superuser")
+
+	// prevent superusers from locking themselves out
+	currentUser := apicontext.ContextGetUser(r)
+	if input.IsSuperuser != nil && !*input.IsSuperuser {
+		v.Check(currentUser.UserID != user.UserID, "is_superuser", "you cannot revoke your own superuser status")
+	}
+
+	if !v.Valid() {
+		h.errors.FailedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	before := *user
+
+	if input.IsStaff != nil {
+		user.IsStaff = *input.IsStaff
+	}
+	if input.IsSuperuser != nil {
+		user.IsSuperuser = *input.IsSuperuser
+	}
+
+	err = h.models.Transaction(r.Context(), func(ctx context.Context) error {
+		err := h.models.Users.Update(ctx, user)
+		if err != nil {
+			return err
+		}
+
+		return h.models.Audit.Record(ctx, data.AuditUserUpdate, data.AuditTargetUser, user.UserID.String(), &before, user)
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrEditConflict):
+			h.errors.EditConflictResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", versionETag(user.Version))
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{"user": user}, headers)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// ShowUserAccessHandler reports the effective roles and permissions of a user and
+// where each of them comes from (directly, a role or a group).
+func (h Handlers) ShowUserAccessHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := helpers.ReadUUIDParam(r)
+	if err != nil {
+		h.errors.NotFoundResponse(w, r)
+		return
+	}
+
+	user, err := h.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !h.authorize(w, r, "users:access", user) {
+		return
+	}
+
+	roles, err := h.models.Roles.GetAccessForUser(r.Context(), user.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	permissions, err := h.models.Permissions.GetAccessForUser(r.Context(), user.UserID)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+		return
+	}
+
+	err = helpers.WriteJSON(w, http.StatusOK, helpers.Envelope{
+		"user_id":      user.UserID,
+		"is_superuser": user.IsSuperuser,
+		"is_staff":     user.IsStaff,
+		"roles":        roles,
+		"permissions":  permissions,
+	}, nil)
+	if err != nil {
+		h.errors.ServerErrorResponse(w, r, err)
+	}
+}
+
+// readUser loads the user from the :id route parameter, which may be "me", writing the
+// error response and returning false if that isn't possible.
+func (h Handlers) readUser(w http.ResponseWriter, r *http.Request) (*data.User, bool) {
+	var id uuid.UUID
+
+	// "me" stands for the current user
+	if httprouter.ParamsFromContext(r.Context()).ByName("id") == "me" {
+		currentUser := apicontext.ContextGetUser(r)
+		if currentUser.IsAnonymousUser() {
+			h.errors.AuthenticationRequiredResponse(w, r)
+			return nil, false
+		}
+
+		id = currentUser.UserID
+	} else {
+		var err error
+
+		id, err = helpers.ReadUUIDParam(r)
+		if err != nil {
+			h.errors.NotFoundResponse(w, r)
+			return nil, false
+		}
+	}
+
+	user, err := h.models.Users.Get(r.Context(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			h.errors.NotFoundResponse(w, r)
+		default:
+			h.errors.ServerErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	return user, true
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	apierrors "github.com/hasahmad/go-skeleton/internal/api/errors"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
+	"github.com/hasahmad/go-skeleton/internal/config"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/hasahmad/go-skeleton/internal/mailer"
+	"github.com/julienschmidt/httprouter"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v4"
+)
+
+// newTestHandlers returns handlers over the models. The emails they send in the
+// background go to a port nothing listens on, and the test waits for them to give up.
+func newTestHandlers(t *testing.T, models data.Models) Handlers {
+	t.Helper()
+
+	return newTestHandlersWithConfig(t, config.Config{}, models)
+}
+
+// newTestHandlersWithConfig is newTestHandlers with the configuration.
+func newTestHandlersWithConfig(t *testing.T, cfg config.Config, models data.Models) Handlers {
+	t.Helper()
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	wg := &sync.WaitGroup{}
+	t.Cleanup(wg.Wait)
+
+	return New(
+		logger,
+		cfg,
+		apierrors.New(logger),
+		models,
+		policies.New(cfg, models),
+		mailer.New("localhost", 1, "", "", "test@example.com"),
+		wg,
+	)
+}
+
+func newTestModels() data.Models {
+	return data.NewMemoryModels(map[string]data.Permissions{"user": {}})
+}
+
+// insertTestUser adds an active user with the email address and username.
+func insertTestUser(t *testing.T, models data.Models, email, username string) *data.User {
+	t.Helper()
+
+	user := &data.User{
+		FirstName: "Alice",
+		Email:     email,
+		Username:  null.StringFrom(username),
+		IsActive:  true,
+	}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(context.Background(), user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user
+}
+
+// decodeErrors returns the validation errors of a 422 response body.
+func decodeErrors(t *testing.T, body io.Reader) map[string]string {
+	t.Helper()
+
+	var envelope struct {
+		Error map[string]string `json:"error"`
+	}
+
+	err := json.NewDecoder(body).Decode(&envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return envelope.Error
+}
+
+func TestRegisterUserHandler(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantCode  int
+		wantError string
+	}{
+		{
+			name:     "valid",
+			body:     `{"first_name": "Bob", "email": "bob@example.com", "username": "bob", "password": "pa55word1234"}`,
+			wantCode: http.StatusAccepted,
+		},
+		{
+			name:      "duplicate email",
+			body:      `{"first_name": "Bob", "email": "alice@example.com", "username": "bob", "password": "pa55word1234"}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "email",
+		},
+		{
+			name:      "duplicate email in another case",
+			body:      `{"first_name": "Bob", "email": "Alice@Example.com", "username": "bob", "password": "pa55word1234"}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "email",
+		},
+		{
+			name:      "duplicate username",
+			body:      `{"first_name": "Bob", "email": "bob@example.com", "username": "alice", "password": "pa55word1234"}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "username",
+		},
+		{
+			name:      "short password",
+			body:      `{"first_name": "Bob", "email": "bob@example.com", "username": "bob", "password": "pa55"}`,
+			wantCode:  http.StatusUnprocessableEntity,
+			wantError: "password",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestModels()
+			h := newTestHandlers(t, models)
+			insertTestUser(t, models, "alice@example.com", "alice")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPost, "/v1/users", strings.NewReader(tt.body))
+
+			h.RegisterUserHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			if tt.wantError != "" {
+				errs := decodeErrors(t, w.Body)
+				if _, ok := errs[tt.wantError]; !ok {
+					t.Errorf("got errors %v, want one for %q", errs, tt.wantError)
+				}
+				return
+			}
+
+			user, err := models.Users.GetByEmail(context.Background(), "bob@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if user.IsActive {
+				t.Error("got an active user, want them to activate their account first")
+			}
+		})
+	}
+}
+
+// concurrentUsers is a UserRepository on which another request updates each user right
+// after it is read, so the version the handlers read is already stale.
+type concurrentUsers struct {
+	data.UserRepository
+}
+
+func (u concurrentUsers) Get(ctx context.Context, id uuid.UUID) (*data.User, error) {
+	user, err := u.UserRepository.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	other := *user
+	err = u.UserRepository.Update(ctx, &other)
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func TestUpdateUserHandlerEditConflict(t *testing.T) {
+	models := newTestModels()
+	user := insertTestUser(t, models, "alice@example.com", "alice")
+
+	models.Users = concurrentUsers{models.Users}
+	h := newTestHandlers(t, models)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPatch, "/v1/users/"+user.UserID.String(), strings.NewReader(`{"email": "alice@example.org"}`))
+	r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: user.UserID.String()}}))
+	r = apicontext.ContextSetUser(r, user)
+	r = apicontext.ContextSetPolicyAllowed(r)
+
+	h.UpdateUserHandler(w, r)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("got status %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+
+	stored, err := models.Users.GetByEmail(context.Background(), "alice@example.com")
+	if err != nil {
+		t.Fatalf("the user's email address changed despite the conflict: %v", err)
+	}
+
+	if stored.Email != "alice@example.com" {
+		t.Errorf("got email %q, want it unchanged", stored.Email)
+	}
+}
+
+func TestUpdateUserFlagsHandlerPreconditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		required bool
+		ifMatch  func(user *data.User) string
+		wantCode int
+	}{
+		{name: "no If-Match", wantCode: http.StatusOK},
+		{name: "no If-Match when required", required: true, wantCode: http.StatusPreconditionRequired},
+		{
+			name:     "current version",
+			required: true,
+			ifMatch:  func(user *data.User) string { return versionETag(user.Version) },
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "stale version",
+			ifMatch:  func(user *data.User) string { return versionETag(user.Version - 1) },
+			wantCode: http.StatusPreconditionFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			models := newTestModels()
+
+			cfg := config.Config{}
+			cfg.Preconditions.Required = tt.required
+			h := newTestHandlersWithConfig(t, cfg, models)
+
+			admin := insertTestUser(t, models, "alice@example.com", "alice")
+			admin.IsSuperuser = true
+			user := insertTestUser(t, models, "bob@example.com", "bob")
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodPatch, "/v1/users/"+user.UserID.String()+"/flags", strings.NewReader(`{"is_staff": true}`))
+			r = r.WithContext(context.WithValue(r.Context(), httprouter.ParamsKey, httprouter.Params{{Key: "id", Value: user.UserID.String()}}))
+			r = apicontext.ContextSetUser(r, admin)
+			if tt.ifMatch != nil {
+				r.Header.Set("If-Match", tt.ifMatch(user))
+			}
+
+			h.UpdateUserFlagsHandler(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			stored, err := models.Users.Get(context.Background(), user.UserID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if stored.IsStaff != (tt.wantCode == http.StatusOK) {
+				t.Errorf("got staff %v after status %d", stored.IsStaff, w.Code)
+			}
+		})
+	}
+}
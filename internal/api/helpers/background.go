@@ -8,7 +8,7 @@ import (
 )
 
 // The background() helper accepts an arbitrary function as a parameter.
-func Background(logger *logrus.Logger, wg sync.WaitGroup, fn func()) {
+func Background(logger *logrus.Logger, wg *sync.WaitGroup, fn func()) {
 	wg.Add(1)
 
 	// Launch a background goroutine.
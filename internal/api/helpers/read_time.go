@@ -0,0 +1,27 @@
+package helpers
+
+import (
+	"net/url"
+	"time"
+
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// ReadTime reads an RFC 3339 timestamp from the query string. If no matching key could
+// be found it returns the zero time. If the value couldn't be parsed, then we record an
+// error message in the provided Validator instance.
+func ReadTime(qs url.Values, key string, v *validator.Validator) (time.Time, bool) {
+	s := qs.Get(key)
+
+	if s == "" {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		v.AddError(key, "must be an RFC 3339 timestamp")
+		return time.Time{}, true
+	}
+
+	return t, true
+}
@@ -53,8 +53,14 @@ func (m Middlewares) Authenticate(next http.Handler) http.Handler {
 			}
 		}
 
+		if user.IsSuspended() {
+			m.errors.AccountSuspendedResponse(w, r)
+			return
+		}
+
 		// set user and serve
 		r = apicontext.ContextSetUser(r, user)
+		r = r.WithContext(data.ContextWithAuditActor(r.Context(), user.UserID))
 		next.ServeHTTP(w, r)
 	})
 }
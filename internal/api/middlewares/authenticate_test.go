@@ -0,0 +1,110 @@
+package middlewares
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	apierrors "github.com/hasahmad/go-skeleton/internal/api/errors"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
+	"github.com/hasahmad/go-skeleton/internal/config"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v4"
+)
+
+func TestAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	models := data.NewMemoryModels(nil)
+
+	user := &data.User{
+		FirstName: "Alice",
+		Email:     "alice@example.com",
+		Username:  null.StringFrom("alice"),
+		IsActive:  true,
+	}
+
+	err := user.Password.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = models.Users.Insert(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := models.Tokens.New(ctx, user.UserID, time.Hour, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := models.Tokens.New(ctx, user.UserID, -time.Minute, data.ScopeAuthentication)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	activation, err := models.Tokens.New(ctx, user.UserID, time.Hour, data.ScopeActivation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		wantCode      int
+		wantAnonymous bool
+	}{
+		{"no token", "", http.StatusOK, true},
+		{"valid token", "Bearer " + valid.Plaintext, http.StatusOK, false},
+		{"expired token", "Bearer " + expired.Plaintext, http.StatusUnauthorized, false},
+		{"token of another scope", "Bearer " + activation.Plaintext, http.StatusUnauthorized, false},
+		{"malformed token", "Bearer " + valid.Plaintext[1:], http.StatusUnauthorized, false},
+		{"not a bearer token", "Basic " + valid.Plaintext, http.StatusUnauthorized, false},
+	}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	cfg := config.Config{}
+	m := New(logger, cfg, apierrors.New(logger), models, policies.New(cfg, models), nil)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *data.User
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = apicontext.ContextGetUser(r)
+			})
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/v1/users", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			m.Authenticate(next).ServeHTTP(w, r)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("got status %d, want %d: %s", w.Code, tt.wantCode, w.Body)
+			}
+
+			if tt.wantCode != http.StatusOK {
+				if got != nil {
+					t.Error("the next handler ran without the user being authenticated")
+				}
+				return
+			}
+
+			if got.IsAnonymousUser() != tt.wantAnonymous {
+				t.Errorf("got anonymous user %v, want %v", got.IsAnonymousUser(), tt.wantAnonymous)
+			}
+			if !tt.wantAnonymous && got.UserID != user.UserID {
+				t.Errorf("got user %s, want %s", got.UserID, user.UserID)
+			}
+		})
+	}
+}
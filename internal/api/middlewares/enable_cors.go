@@ -14,6 +14,7 @@ func (m Middlewares) EnableCORS(next http.Handler) http.Handler {
 			for i := range m.cfg.Cors.TrustedOrigins {
 				if origin == m.cfg.Cors.TrustedOrigins[i] {
 					w.Header().Set("Access-Control-Allow-Origin", origin)
+					w.Header().Set("Access-Control-Expose-Headers", "ETag")
 
 					// Check if the request has the HTTP method OPTIONS and contains the
 					// "Access-Control-Request-Method" header. If it does, then we treat
@@ -21,7 +22,7 @@ func (m Middlewares) EnableCORS(next http.Handler) http.Handler {
 					if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
 						// Set the necessary preflight response headers
 						w.Header().Set("Access-Control-Allow-Methods", "OPTIONS, PUT, PATCH, DELETE")
-						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+						w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, If-Match, If-None-Match, X-Organization-ID, X-Request-ID")
 
 						w.WriteHeader(http.StatusOK)
 						return
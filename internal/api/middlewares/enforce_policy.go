@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/authz"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// EnforcePolicy checks the request against the authorization policy file, if one is
+// configured. Denied requests are rejected, and in "replace" mode allowed requests skip
+// the route permission and role checks, though not the checks of the handlers on whose
+// records they act (see Handlers.authorize). Requests no rule matches fall through to
+// the route checks.
+func (m Middlewares) EnforcePolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if m.enforcer == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := apicontext.ContextGetUser(r)
+
+		var roles data.Roles
+		if !user.IsAnonymousUser() {
+			var err error
+			r, roles, err = m.loadRoles(r)
+			if err != nil {
+				m.errors.ServerErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		decision := m.enforcer.Enforce(authz.NewSubject(user, roles), r.Method, r.URL.Path)
+
+		switch decision.Effect {
+		case authz.EffectDeny:
+			if user.IsAnonymousUser() {
+				m.errors.AuthenticationRequiredResponse(w, r)
+			} else {
+				m.errors.NotPermittedResponse(w, r)
+			}
+			return
+		case authz.EffectAllow:
+			if m.cfg.Authz.PolicyMode == "replace" {
+				r = apicontext.ContextSetPolicyAllowed(r)
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
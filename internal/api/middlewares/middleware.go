@@ -2,23 +2,36 @@ package middlewares
 
 import (
 	apierrors "github.com/hasahmad/go-skeleton/internal/api/errors"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
+	"github.com/hasahmad/go-skeleton/internal/authz"
 	"github.com/hasahmad/go-skeleton/internal/config"
 	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/sirupsen/logrus"
 )
 
 type Middlewares struct {
-	logger *logrus.Logger
-	cfg    config.Config
-	errors apierrors.ErrorResponses
-	models data.Models
+	logger   *logrus.Logger
+	cfg      config.Config
+	errors   apierrors.ErrorResponses
+	models   data.Models
+	policies policies.Policies
+	enforcer *authz.Enforcer
 }
 
-func New(logger *logrus.Logger, cfg config.Config, errors apierrors.ErrorResponses, models data.Models) Middlewares {
+func New(
+	logger *logrus.Logger,
+	cfg config.Config,
+	errors apierrors.ErrorResponses,
+	models data.Models,
+	policies policies.Policies,
+	enforcer *authz.Enforcer,
+) Middlewares {
 	return Middlewares{
-		logger: logger,
-		cfg:    cfg,
-		errors: errors,
-		models: models,
+		logger:   logger,
+		cfg:      cfg,
+		errors:   errors,
+		models:   models,
+		policies: policies,
+		enforcer: enforcer,
 	}
 }
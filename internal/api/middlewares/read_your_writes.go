@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// ReadYourWrites runs the queries of the requests which may write on the primary, and
+// so do the requests of their user for a while after (-db-replica-stickiness), so the
+// clients read their own writes whatever the replication lag. It does nothing without
+// read replicas.
+func (m Middlewares) ReadYourWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		replicas := m.models.Replicas
+		if replicas == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user := apicontext.ContextGetUser(r)
+		writes := r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodOptions
+
+		if writes || (!user.IsAnonymousUser() && replicas.WroteRecently(user.UserID)) {
+			r = r.WithContext(data.ContextWithPrimary(r.Context()))
+		}
+
+		next.ServeHTTP(w, r)
+
+		if writes && !user.IsAnonymousUser() {
+			replicas.NoteWrite(user.UserID)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	"github.com/tomasen/realip"
+)
+
+// RequestID gives every request an ID, taken from the X-Request-ID header if the client
+// (or a proxy) sent a sensible one and generated otherwise. The ID is sent back in the
+// X-Request-ID response header and stored, with the client IP, in the audit source of
+// the request context.
+func (m Middlewares) RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set("X-Request-ID", id)
+
+		ctx := data.ContextWithAuditSource(r.Context(), data.AuditSource{
+			IP:        realip.FromRequest(r),
+			RequestID: id,
+		})
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+
+	return true
+}
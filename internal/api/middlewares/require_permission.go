@@ -4,19 +4,48 @@ import (
 	"net/http"
 
 	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
 )
 
 func (m Middlewares) RequirePermission(code string, next http.HandlerFunc) http.HandlerFunc {
+	return m.requirePermissions(func(permissions data.Permissions) bool {
+		return permissions.Include(code)
+	}, next)
+}
+
+// RequireAnyPermission only lets the request through if the user has been granted at
+// least one of the permission codes.
+func (m Middlewares) RequireAnyPermission(codes []string, next http.HandlerFunc) http.HandlerFunc {
+	return m.requirePermissions(func(permissions data.Permissions) bool {
+		return permissions.IncludeMultiple(codes, true)
+	}, next)
+}
+
+// RequireAllPermissions only lets the request through if the user has been granted
+// every one of the permission codes.
+func (m Middlewares) RequireAllPermissions(codes []string, next http.HandlerFunc) http.HandlerFunc {
+	return m.requirePermissions(func(permissions data.Permissions) bool {
+		return permissions.IncludeMultiple(codes, false)
+	}, next)
+}
+
+func (m Middlewares) requirePermissions(allowed func(data.Permissions) bool, next http.HandlerFunc) http.HandlerFunc {
 	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		user := apicontext.ContextGetUser(r)
 
-		permissions, err := m.models.Permissions.GetAllForUser(r.Context(), user.UserID)
+		// superusers implicitly have every permission
+		if user.IsSuperuser || apicontext.ContextPolicyAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r, permissions, err := m.policies.Permissions(r)
 		if err != nil {
 			m.errors.ServerErrorResponse(w, r, err)
 			return
 		}
 
-		if !permissions.Include(code) {
+		if !allowed(permissions) {
 			m.errors.NotPermittedResponse(w, r)
 			return
 		}
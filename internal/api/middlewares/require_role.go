@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// RequireRole returns a middleware which only lets the request through if the user has
+// every one of the role codes.
+func (m Middlewares) RequireRole(codes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return m.requireRoles(func(roles data.Roles) bool {
+			return roles.IncludeMultiple(codes, false)
+		}, next)
+	}
+}
+
+// RequireAnyRole returns a middleware which only lets the request through if the user
+// has at least one of the role codes.
+func (m Middlewares) RequireAnyRole(codes ...string) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return m.requireRoles(func(roles data.Roles) bool {
+			return roles.IncludeMultiple(codes, true)
+		}, next)
+	}
+}
+
+func (m Middlewares) requireRoles(allowed func(data.Roles) bool, next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := apicontext.ContextGetUser(r)
+
+		// superusers pass every role check, same as permission checks
+		if user.IsSuperuser || apicontext.ContextPolicyAllowed(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		r, roles, err := m.loadRoles(r)
+		if err != nil {
+			m.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		if !allowed(roles) {
+			m.errors.NotPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return m.RequireActivatedUser(fn)
+}
+
+// loadRoles returns the roles of the current user within the active organization (if
+// any), reading them from the request
+// context if an earlier middleware already loaded them.
+func (m Middlewares) loadRoles(r *http.Request) (*http.Request, data.Roles, error) {
+	if roles, ok := apicontext.ContextGetRoles(r); ok {
+		return r, roles, nil
+	}
+
+	user := apicontext.ContextGetUser(r)
+
+	var roles data.Roles
+	var err error
+
+	if tenant := apicontext.ContextGetTenant(r); tenant != nil {
+		roles, err = m.models.Roles.GetAllForUserInOrganization(r.Context(), user.UserID, tenant.Organization.OrganizationID)
+	} else {
+		roles, err = m.models.Roles.GetAllForUser(r.Context(), user.UserID)
+	}
+	if err != nil {
+		return r, nil, err
+	}
+
+	return apicontext.ContextSetRoles(r, roles), roles, nil
+}
@@ -0,0 +1,22 @@
+package middlewares
+
+import (
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+)
+
+func (m Middlewares) RequireSuperuser(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user := apicontext.ContextGetUser(r)
+
+		if !user.IsSuperuser {
+			m.errors.NotPermittedResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return m.RequireActivatedUser(fn)
+}
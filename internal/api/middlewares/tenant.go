@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/api/helpers"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// Tenant sets the active organization from the X-Organization-ID header, if present.
+// The user must be a member of the organization (or a superuser).
+func (m Middlewares) Tenant(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "X-Organization-ID")
+
+		header := r.Header.Get("X-Organization-ID")
+		if header == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		orgID, err := uuid.Parse(header)
+		if err != nil {
+			m.errors.BadRequestResponse(w, r, errors.New("invalid X-Organization-ID header"))
+			return
+		}
+
+		r, ok := m.setTenant(w, r, orgID)
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireOrganization sets the active organization from the :org_id route parameter,
+// for routes under /v1/orgs/:org_id/. The user must be a member of the organization (or
+// a superuser).
+func (m Middlewares) RequireOrganization(next http.HandlerFunc) http.HandlerFunc {
+	fn := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		orgID, err := helpers.ReadUUIDParamByKey(r, "org_id")
+		if err != nil {
+			m.errors.NotFoundResponse(w, r)
+			return
+		}
+
+		if tenant := apicontext.ContextGetTenant(r); tenant != nil && tenant.Organization.OrganizationID != orgID {
+			m.errors.BadRequestResponse(w, r, errors.New("X-Organization-ID header doesn't match the organization in the path"))
+			return
+		}
+
+		r, ok := m.setTenant(w, r, orgID)
+		if !ok {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+
+	return m.RequireActivatedUser(fn)
+}
+
+// setTenant loads the organization and the membership of the current user and stores
+// them in the request context. It writes the error response and returns false if the
+// user can't act within the organization.
+func (m Middlewares) setTenant(w http.ResponseWriter, r *http.Request, orgID uuid.UUID) (*http.Request, bool) {
+	user := apicontext.ContextGetUser(r)
+
+	if user.IsAnonymousUser() {
+		m.errors.AuthenticationRequiredResponse(w, r)
+		return r, false
+	}
+
+	org, err := m.models.Organizations.Get(r.Context(), orgID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound):
+			m.errors.NotFoundResponse(w, r)
+		default:
+			m.errors.ServerErrorResponse(w, r, err)
+		}
+		return r, false
+	}
+
+	membership, err := m.models.Organizations.GetMembership(r.Context(), orgID, user.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, data.ErrRecordNotFound) && user.IsSuperuser:
+			membership = nil
+		case errors.Is(err, data.ErrRecordNotFound):
+			m.errors.NotPermittedResponse(w, r)
+			return r, false
+		default:
+			m.errors.ServerErrorResponse(w, r, err)
+			return r, false
+		}
+	}
+
+	// restrict the row level security policies to the organization, if enabled
+	err = data.SetSessionTenant(r.Context(), orgID, user.UserID)
+	if err != nil {
+		m.errors.ServerErrorResponse(w, r, err)
+		return r, false
+	}
+
+	r = r.WithContext(data.ContextWithAuditOrganization(r.Context(), orgID))
+
+	return apicontext.ContextSetTenant(r, org, membership), true
+}
@@ -0,0 +1,87 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// TenantTransaction runs the rest of the request in a database transaction which has
+// app.current_user set to the current user, and app.current_tenant set to the active
+// organization once it is known (see setTenant). The row level security policies
+// created by the migrations use these settings, so a query missing its tenant
+// condition still can't see other tenants' rows. The requests outside an organization
+// are the global ones, like logging in or the admin routes, and keep app.bypass_rls on
+// until setTenant turns it off. It does nothing unless enabled with
+// -db-row-level-security, nor with the in-memory models.
+//
+// The handlers' Models.Transaction calls join this transaction rather than begin their
+// own, so they are not retried on deadlocks or serialization failures: the request
+// fails instead, with 409 Conflict where the handler reports the data errors, and it is
+// up to the client to retry it.
+//
+// The audit events recorded by the handlers are appended to the audit chain as the
+// transaction commits (see data.Commit), so the requests only wait on each other for
+// the lock serializing the chain while committing, not while the handlers run.
+//
+// The response is buffered so the transaction can be committed before anything is sent
+// to the client. Responses with an error status roll the transaction back.
+func (m Middlewares) TenantTransaction(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.cfg.DB.RowLevelSecurity || m.models.DB == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tx, err := m.models.DB.BeginTxx(r.Context(), nil)
+		if err != nil {
+			m.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		// a no-op once the transaction has been committed
+		defer tx.Rollback()
+
+		r = r.WithContext(data.ContextWithTx(r.Context(), tx))
+
+		user := apicontext.ContextGetUser(r)
+		err = data.SetSessionGlobal(r.Context(), user.UserID)
+		if err != nil {
+			m.errors.ServerErrorResponse(w, r, err)
+			return
+		}
+
+		bw := &bufferedResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(bw, r)
+
+		if bw.status < http.StatusBadRequest {
+			err = data.Commit(r.Context())
+			if err != nil {
+				m.errors.ServerErrorResponse(w, r, err)
+				return
+			}
+		}
+
+		w.WriteHeader(bw.status)
+		w.Write(bw.body.Bytes())
+	})
+}
+
+// bufferedResponseWriter holds on to the status and body written by the handlers.
+// Headers are written straight to the underlying http.ResponseWriter's header map as
+// they aren't sent until WriteHeader is called on it.
+type bufferedResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(status int) {
+	bw.status = status
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return bw.body.Write(b)
+}
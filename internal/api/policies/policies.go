@@ -0,0 +1,98 @@
+package policies
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	apicontext "github.com/hasahmad/go-skeleton/internal/api/context"
+	"github.com/hasahmad/go-skeleton/internal/config"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// Resource is anything an actor can act on which belongs to a user.
+type Resource interface {
+	OwnerID() uuid.UUID
+}
+
+// Rule is an attribute-based check for an action. It is only consulted when the
+// permission codes alone didn't grant access.
+type Rule func(actor *data.User, permissions data.Permissions, resource Resource) bool
+
+type Policies struct {
+	cfg    config.Config
+	models data.Models
+	rules  map[string][]Rule
+}
+
+func New(cfg config.Config, models data.Models) Policies {
+	return Policies{
+		cfg:    cfg,
+		models: models,
+		rules:  make(map[string][]Rule),
+	}
+}
+
+// AddRule registers an additional rule for the action.
+func (p Policies) AddRule(action string, rule Rule) {
+	p.rules[action] = append(p.rules[action], rule)
+}
+
+// Can reports whether the actor may perform the action (e.g. "users:edit") on the
+// resource. Access is granted to superusers, to holders of the bare action code or of
+// "<action>:any", to holders of "<action>:own" when they own the resource, and finally
+// when any rule registered for the action allows it. resource may be nil for actions
+// which don't target a specific record.
+func (p Policies) Can(actor *data.User, permissions data.Permissions, action string, resource Resource) bool {
+	if actor.IsAnonymousUser() {
+		return false
+	}
+
+	if actor.IsSuperuser {
+		return true
+	}
+
+	if permissions.Include(action) || permissions.Include(action+":any") {
+		return true
+	}
+
+	if resource != nil && resource.OwnerID() == actor.UserID && permissions.Include(action+":own") {
+		return true
+	}
+
+	for _, rule := range p.rules[action] {
+		if rule(actor, permissions, resource) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Permissions returns the effective permissions of the current user within the active
+// organization (if any), including the configured staff permissions. They are loaded once and stored in the request context,
+// so use the returned request from then on.
+func (p Policies) Permissions(r *http.Request) (*http.Request, data.Permissions, error) {
+	if permissions, ok := apicontext.ContextGetPermissions(r); ok {
+		return r, permissions, nil
+	}
+
+	user := apicontext.ContextGetUser(r)
+
+	var permissions data.Permissions
+	var err error
+
+	if tenant := apicontext.ContextGetTenant(r); tenant != nil {
+		permissions, err = p.models.Permissions.GetAllForUserInOrganization(r.Context(), user.UserID, tenant.Organization.OrganizationID)
+	} else {
+		permissions, err = p.models.Permissions.GetAllForUser(r.Context(), user.UserID)
+	}
+	if err != nil {
+		return r, nil, err
+	}
+
+	if user.IsStaff {
+		permissions = append(permissions, p.cfg.Auth.StaffPermissions...)
+	}
+
+	return apicontext.ContextSetPermissions(r, permissions), permissions, nil
+}
@@ -6,6 +6,8 @@ import (
 	apierrors "github.com/hasahmad/go-skeleton/internal/api/errors"
 	"github.com/hasahmad/go-skeleton/internal/api/handlers"
 	"github.com/hasahmad/go-skeleton/internal/api/middlewares"
+	"github.com/hasahmad/go-skeleton/internal/api/policies"
+	"github.com/hasahmad/go-skeleton/internal/authz"
 	"github.com/hasahmad/go-skeleton/internal/config"
 	"github.com/hasahmad/go-skeleton/internal/data"
 	"github.com/hasahmad/go-skeleton/internal/mailer"
@@ -20,28 +22,39 @@ type Application struct {
 	errors      apierrors.ErrorResponses
 	mailer      mailer.Mailer
 	models      data.Models
+	enforcer    *authz.Enforcer
 	handlers    handlers.Handlers
 	middlewares middlewares.Middlewares
-	wg          sync.WaitGroup
+	wg          *sync.WaitGroup
+	// closed on shutdown to stop the background jobs
+	quit chan struct{}
 }
 
 func NewApplication(
 	logger *logrus.Logger,
 	cfg config.Config,
 	db *sqlx.DB,
-	wg sync.WaitGroup,
+	replicas *data.Replicas,
+	enforcer *authz.Enforcer,
+	wg *sync.WaitGroup,
 ) *Application {
 	errorReps := apierrors.New(logger)
 	models := data.NewModels(db)
+	if replicas != nil {
+		models = models.WithReplicas(replicas)
+	}
+	policies := policies.New(cfg, models)
 	mailer := mailer.New(cfg.Smtp.Host, cfg.Smtp.Port, cfg.Smtp.Username, cfg.Smtp.Password, cfg.Smtp.Sender)
 	return &Application{
 		logger:      logger,
 		cfg:         cfg,
 		errors:      errorReps,
 		wg:          wg,
+		quit:        make(chan struct{}),
 		mailer:      mailer,
 		models:      models,
-		middlewares: middlewares.New(logger, cfg, errorReps, models),
-		handlers:    handlers.New(logger, cfg, errorReps, models, mailer, wg),
+		enforcer:    enforcer,
+		middlewares: middlewares.New(logger, cfg, errorReps, models, policies, enforcer),
+		handlers:    handlers.New(logger, cfg, errorReps, models, policies, mailer, wg),
 	}
 }
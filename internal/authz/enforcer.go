@@ -0,0 +1,105 @@
+package authz
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Enforcer holds the policy loaded from a file and can reload it when the file
+// changes. It is safe for concurrent use.
+type Enforcer struct {
+	file    string
+	mu      sync.RWMutex
+	policy  *Policy
+	modTime time.Time
+}
+
+// NewEnforcer loads the policy file.
+func NewEnforcer(file string) (*Enforcer, error) {
+	e := &Enforcer{file: file}
+
+	err := e.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Load (re)reads the policy file. The current policy is kept if the file is invalid.
+func (e *Enforcer) Load() error {
+	f, err := os.Open(e.file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	policy, err := Parse(f)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	e.policy = policy
+	e.modTime = info.ModTime()
+	e.mu.Unlock()
+
+	return nil
+}
+
+// Enforce evaluates the current policy.
+func (e *Enforcer) Enforce(sub Subject, method, path string) Decision {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.policy.Evaluate(sub, method, path)
+}
+
+// Watch checks the policy file for changes every interval and reloads it when its
+// modification time changes. It returns once quit is closed, so run it in its own
+// goroutine.
+func (e *Enforcer) Watch(interval time.Duration, logger *logrus.Logger, quit <-chan struct{}) {
+	e.mu.RLock()
+	lastSeen := e.modTime
+	e.mu.RUnlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(e.file)
+		if err != nil {
+			logger.WithFields(logrus.Fields{"file": e.file}).Error(err)
+			continue
+		}
+
+		// only try each version of the file once, so an invalid file is logged once
+		// instead of on every tick
+		if info.ModTime().Equal(lastSeen) {
+			continue
+		}
+		lastSeen = info.ModTime()
+
+		err = e.Load()
+		if err != nil {
+			logger.WithFields(logrus.Fields{"file": e.file}).Error(err)
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{"file": e.file}).Info("authorization policy reloaded")
+	}
+}
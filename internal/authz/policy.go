@@ -0,0 +1,289 @@
+package authz
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/data"
+)
+
+// Effect is the outcome of a rule, or of a whole policy evaluation.
+type Effect string
+
+const (
+	EffectAllow   Effect = "allow"
+	EffectDeny    Effect = "deny"
+	EffectNoMatch Effect = "no match"
+)
+
+// Combining algorithms, set with an "e" line in the policy file.
+const (
+	DenyOverride  = "deny-override"
+	AllowOverride = "allow-override"
+	FirstMatch    = "first-match"
+)
+
+// Subject is who is making the request.
+type Subject struct {
+	UserID    uuid.UUID
+	Email     string
+	Anonymous bool
+	Superuser bool
+	Staff     bool
+	Roles     []string
+}
+
+// NewSubject returns the subject for a user and their roles.
+func NewSubject(user *data.User, roles data.Roles) Subject {
+	if user.IsAnonymousUser() {
+		return Subject{Anonymous: true}
+	}
+
+	return Subject{
+		UserID:    user.UserID,
+		Email:     user.Email,
+		Superuser: user.IsSuperuser,
+		Staff:     user.IsStaff,
+		Roles:     roles,
+	}
+}
+
+// Rule is a single "p" line of the policy file.
+type Rule struct {
+	Line    int
+	Subject string
+	Object  string
+	Methods []string
+	Effect  Effect
+}
+
+func (r Rule) String() string {
+	return fmt.Sprintf("line %d: p, %s, %s, %s, %s", r.Line, r.Subject, r.Object, strings.Join(r.Methods, "|"), r.Effect)
+}
+
+// Decision is the result of evaluating a policy. Rule is the rule which decided it and
+// is nil when no rule matched.
+type Decision struct {
+	Effect Effect
+	Rule   *Rule
+}
+
+// Policy is a parsed policy file. The format is a line based, comma separated list
+// in the spirit of Casbin:
+//
+//	# combining algorithm: deny-override (default), allow-override or first-match
+//	e, deny-override
+//
+//	# p, subject, object, methods, effect
+//	p, anonymous, /v1/users, POST, allow
+//	p, role:admin, /v1/*, *, allow
+//	p, role:user, /v1/users/:id, GET|PATCH, allow
+//	p, *, /debug/*, *, deny
+//
+//	# g, user (email or id), role: grant a role to a user for this policy only
+//	g, alice@example.com, admin
+//
+// Subjects are "*", "anonymous", "authenticated", "superuser", "staff",
+// "role:<code>" or "user:<email or id>". Objects are URL paths where ":name" and "*"
+// match a single segment and a trailing "*" matches the rest of the path. Methods are
+// "*" or a "|" separated list.
+type Policy struct {
+	Algorithm string
+	Rules     []Rule
+	Groups    map[string][]string
+}
+
+// Parse reads a policy from r.
+func Parse(r io.Reader) (*Policy, error) {
+	policy := &Policy{
+		Algorithm: DenyOverride,
+		Groups:    make(map[string][]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+
+	for scanner.Scan() {
+		line++
+
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Split(text, ",")
+		for i := range fields {
+			fields[i] = strings.TrimSpace(fields[i])
+		}
+
+		switch fields[0] {
+		case "e":
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("line %d: expected \"e, algorithm\"", line)
+			}
+			switch fields[1] {
+			case DenyOverride, AllowOverride, FirstMatch:
+				policy.Algorithm = fields[1]
+			default:
+				return nil, fmt.Errorf("line %d: unknown combining algorithm %q", line, fields[1])
+			}
+		case "p":
+			if len(fields) != 5 {
+				return nil, fmt.Errorf("line %d: expected \"p, subject, object, methods, effect\"", line)
+			}
+
+			effect := Effect(fields[4])
+			if effect != EffectAllow && effect != EffectDeny {
+				return nil, fmt.Errorf("line %d: effect must be allow or deny", line)
+			}
+
+			if fields[1] == "" || !strings.HasPrefix(fields[2], "/") && fields[2] != "*" {
+				return nil, fmt.Errorf("line %d: invalid subject or object", line)
+			}
+
+			methods := strings.Split(strings.ToUpper(fields[3]), "|")
+			for i := range methods {
+				methods[i] = strings.TrimSpace(methods[i])
+			}
+
+			policy.Rules = append(policy.Rules, Rule{
+				Line:    line,
+				Subject: fields[1],
+				Object:  fields[2],
+				Methods: methods,
+				Effect:  effect,
+			})
+		case "g":
+			if len(fields) != 3 || fields[1] == "" || fields[2] == "" {
+				return nil, fmt.Errorf("line %d: expected \"g, user, role\"", line)
+			}
+			policy.Groups[fields[1]] = append(policy.Groups[fields[1]], fields[2])
+		default:
+			return nil, fmt.Errorf("line %d: unknown line type %q", line, fields[0])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return policy, nil
+}
+
+// Evaluate decides whether the subject may use method on path.
+func (p *Policy) Evaluate(sub Subject, method, path string) Decision {
+	var allow, deny *Rule
+
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+
+		if !matchMethod(rule.Methods, method) || !matchPath(rule.Object, path) || !p.matchSubject(rule.Subject, sub) {
+			continue
+		}
+
+		if p.Algorithm == FirstMatch {
+			return Decision{Effect: rule.Effect, Rule: rule}
+		}
+
+		if rule.Effect == EffectAllow && allow == nil {
+			allow = rule
+		}
+		if rule.Effect == EffectDeny && deny == nil {
+			deny = rule
+		}
+	}
+
+	switch {
+	case p.Algorithm == AllowOverride && allow != nil:
+		return Decision{Effect: EffectAllow, Rule: allow}
+	case deny != nil:
+		return Decision{Effect: EffectDeny, Rule: deny}
+	case allow != nil:
+		return Decision{Effect: EffectAllow, Rule: allow}
+	}
+
+	return Decision{Effect: EffectNoMatch}
+}
+
+func (p *Policy) matchSubject(pattern string, sub Subject) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case pattern == "anonymous":
+		return sub.Anonymous
+	case pattern == "authenticated":
+		return !sub.Anonymous
+	case pattern == "superuser":
+		return !sub.Anonymous && sub.Superuser
+	case pattern == "staff":
+		return !sub.Anonymous && sub.Staff
+	case strings.HasPrefix(pattern, "user:"):
+		user := strings.TrimPrefix(pattern, "user:")
+		return !sub.Anonymous && (strings.EqualFold(user, sub.Email) || user == sub.UserID.String())
+	case strings.HasPrefix(pattern, "role:"):
+		if sub.Anonymous {
+			return false
+		}
+
+		role := strings.TrimPrefix(pattern, "role:")
+		for _, r := range sub.Roles {
+			if r == role {
+				return true
+			}
+		}
+		for _, r := range p.Groups[sub.Email] {
+			if r == role {
+				return true
+			}
+		}
+		for _, r := range p.Groups[sub.UserID.String()] {
+			if r == role {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func matchMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == "*" || m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchPath(pattern, path string) bool {
+	if pattern == "*" || pattern == path {
+		return true
+	}
+
+	p := strings.Split(strings.Trim(pattern, "/"), "/")
+	s := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i := range p {
+		if p[i] == "*" && i == len(p)-1 {
+			return i < len(s)
+		}
+
+		if i >= len(s) {
+			return false
+		}
+
+		if p[i] == "*" || strings.HasPrefix(p[i], ":") {
+			continue
+		}
+
+		if p[i] != s[i] {
+			return false
+		}
+	}
+
+	return len(p) == len(s)
+}
@@ -1,9 +1,11 @@
 package config
 
 import (
+	"errors"
 	"flag"
 	"os"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,6 +16,15 @@ type Config struct {
 		MaxOpenConns int
 		MaxIdleConns int
 		MaxIdleTime  string
+		// run every request in a transaction with the tenant settings used by the
+		// row level security policies
+		RowLevelSecurity bool
+		// read replicas the read-only queries are spread over, how often their health
+		// is checked, and how long the reads of a user stay on the primary after they
+		// wrote
+		ReplicaDSNs          []string
+		ReplicaCheckInterval time.Duration
+		ReplicaStickiness    time.Duration
 	}
 	// rps = requests-per-second
 	// enable/disable rate limiting altogether
@@ -32,6 +43,36 @@ type Config struct {
 	Cors struct {
 		TrustedOrigins []string
 	}
+	// permissions granted to every staff user on top of their own
+	Auth struct {
+		StaffPermissions []string
+	}
+	// optional policy file enforced on every request. In "complement" mode the
+	// route permission checks still apply after the policy allowed a request, in
+	// "replace" mode an allow from the policy skips them.
+	Authz struct {
+		PolicyFile     string
+		PolicyMode     string
+		ReloadInterval time.Duration
+	}
+	// the secret signing the cursors of the list endpoints. A random one is used if
+	// empty, so the cursors don't outlive the process.
+	Pagination struct {
+		CursorSecret string
+	}
+	// require an If-Match header on the updates and deletes of the resources having an
+	// ETag, instead of only checking it when there is one
+	Preconditions struct {
+		Required bool
+	}
+	// how often the background jobs run, 0 disables a job
+	Jobs struct {
+		GrantSweepInterval      time.Duration
+		SuspensionSweepInterval time.Duration
+		UserPurgeInterval       time.Duration
+		// how long soft-deleted users are kept before being purged
+		UserRetention time.Duration
+	}
 }
 
 func InitByFlag() (Config, error) {
@@ -44,6 +85,15 @@ func InitByFlag() (Config, error) {
 	flag.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", 25, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.DB.MaxIdleConns, "db-max-idle-conns", 25, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.DB.MaxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	flag.BoolVar(&cfg.DB.RowLevelSecurity, "db-row-level-security", false, "Run requests in a transaction scoped to the active tenant for row level security")
+
+	cfg.DB.ReplicaDSNs = []string{}
+	flag.Func("db-replica-dsns", "PostgreSQL read replica DSNs (space separated)", func(s string) error {
+		cfg.DB.ReplicaDSNs = strings.Fields(s)
+		return nil
+	})
+	flag.DurationVar(&cfg.DB.ReplicaCheckInterval, "db-replica-check-interval", 10*time.Second, "Interval for checking the health of the read replicas (0 disables)")
+	flag.DurationVar(&cfg.DB.ReplicaStickiness, "db-replica-stickiness", 5*time.Second, "How long the reads of a user go to the primary after they wrote")
 
 	flag.Float64Var(&cfg.Limiter.RPS, "limiter-rps", 2, "Rate limiter maximum requests per second")
 	flag.IntVar(&cfg.Limiter.Burst, "limiter-burst", 4, "Rate limiter maximum burst")
@@ -61,5 +111,33 @@ func InitByFlag() (Config, error) {
 		return nil
 	})
 
+	cfg.Auth.StaffPermissions = []string{"users:list", "users:show"}
+	flag.Func("auth-staff-permissions", "Permissions granted to staff users (space separated)", func(s string) error {
+		cfg.Auth.StaffPermissions = strings.Fields(s)
+		return nil
+	})
+
+	flag.StringVar(&cfg.Authz.PolicyFile, "authz-policy-file", "", "Authorization policy file (disabled if empty)")
+	cfg.Authz.PolicyMode = "complement"
+	flag.Func("authz-policy-mode", "Authorization policy mode (complement|replace) (default \"complement\")", func(s string) error {
+		if s != "complement" && s != "replace" {
+			return errors.New(`must be "complement" or "replace"`)
+		}
+		cfg.Authz.PolicyMode = s
+		return nil
+	})
+	flag.DurationVar(&cfg.Authz.ReloadInterval, "authz-policy-reload-interval", 30*time.Second, "Authorization policy file reload check interval (0 disables)")
+
+	flag.StringVar(&cfg.Pagination.CursorSecret, "pagination-cursor-secret", os.Getenv("PAGINATION_CURSOR_SECRET"), "Secret signing the pagination cursors (random if empty)")
+
+	flag.BoolVar(&cfg.Preconditions.Required, "preconditions-required", false, "Require If-Match on updates and deletes of resources with an ETag")
+
+	flag.DurationVar(&cfg.Jobs.GrantSweepInterval, "jobs-grant-sweep-interval", time.Minute, "Interval for deleting expired role and permission grants (0 disables)")
+
+	flag.DurationVar(&cfg.Jobs.SuspensionSweepInterval, "jobs-suspension-sweep-interval", time.Minute, "Interval for lifting expired user suspensions (0 disables)")
+
+	flag.DurationVar(&cfg.Jobs.UserPurgeInterval, "jobs-user-purge-interval", time.Hour, "Interval for purging soft-deleted users past their retention (0 disables)")
+	flag.DurationVar(&cfg.Jobs.UserRetention, "jobs-user-retention", 30*24*time.Hour, "How long soft-deleted users are kept before being purged")
+
 	return cfg, nil
 }
@@ -0,0 +1,335 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditUserRegister  = "users.register"
+	AuditUserActivate  = "users.activate"
+	AuditUserUpdate    = "users.update"
+	AuditUserDelete    = "users.delete"
+	AuditUserRestore   = "users.restore"
+	AuditUserPurge     = "users.purge"
+	AuditUserExport    = "users.export"
+	AuditUserErase     = "users.erase"
+	AuditUserGrant     = "users.grant"
+	AuditUserRevoke    = "users.revoke"
+	AuditUserSuspend   = "users.suspend"
+	AuditUserUnsuspend = "users.unsuspend"
+	AuditGrantExpire   = "users.grant_expire"
+	AuditLogin         = "auth.login"
+	AuditLoginFailed   = "auth.login_failed"
+	AuditTokenCreate   = "tokens.create"
+)
+
+// Types of the records audit events are about.
+const (
+	AuditTargetUser = "user"
+)
+
+// AuditEvent records who did what to which record, and from where. The events form a
+// hash chain (see ComputeHash), so altering or removing one is detected by VerifyChain.
+type AuditEvent struct {
+	AuditEventID   uuid.UUID     `json:"audit_event_id" db:"audit_event_id"`
+	Sequence       int64         `json:"sequence" db:"sequence"`
+	ActorID        uuid.NullUUID `json:"actor_id" db:"actor_id"`
+	OrganizationID uuid.NullUUID `json:"organization_id" db:"organization_id"`
+	Action         string        `json:"action" db:"action"`
+	TargetType     string        `json:"target_type" db:"target_type"`
+	TargetID       string        `json:"target_id" db:"target_id"`
+	Changes        AuditChanges  `json:"changes" db:"changes"`
+	IP             string        `json:"ip" db:"ip"`
+	RequestID      string        `json:"request_id" db:"request_id"`
+	CreatedAt      time.Time     `json:"created_at" db:"created_at"`
+	PrevHash       string        `json:"prev_hash" db:"prev_hash"`
+	Hash           string        `json:"hash" db:"hash"`
+}
+
+// AuditChange is the value of a field before and after the change.
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChanges maps the changed fields to their change, stored as jsonb.
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	if c == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(c)
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+	b, ok := value.([]byte)
+	if !ok {
+		return errors.New("unable to convert audit changes")
+	}
+	return json.Unmarshal(b, c)
+}
+
+// AuditDiff returns the fields whose JSON representation differs between before and
+// after. Pass nil as before for created records and as after for deleted ones.
+func AuditDiff(before, after interface{}) (AuditChanges, error) {
+	b, err := auditFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := auditFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := AuditChanges{}
+	for key, value := range b {
+		if !reflect.DeepEqual(value, a[key]) {
+			changes[key] = AuditChange{Before: value, After: a[key]}
+		}
+	}
+	for key, value := range a {
+		if _, ok := b[key]; !ok {
+			changes[key] = AuditChange{After: value}
+		}
+	}
+	// bumped by every update
+	delete(changes, "updated_at")
+
+	return changes, nil
+}
+
+func auditFields(v interface{}) (map[string]interface{}, error) {
+	fields := map[string]interface{}{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Ptr && reflect.ValueOf(v).IsNil() {
+		return fields, nil
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(js, &fields)
+	return fields, err
+}
+
+// AuditSource is where the changes made during a request come from. It is stored in
+// the context by the middlewares so the models can add it to the audit events.
+type AuditSource struct {
+	ActorID        uuid.UUID
+	OrganizationID uuid.UUID
+	IP             string
+	RequestID      string
+}
+
+const auditSourceContextKey = contextKey("audit_source")
+
+// ContextWithAuditSource returns a copy of ctx carrying the audit source.
+func ContextWithAuditSource(ctx context.Context, src AuditSource) context.Context {
+	return context.WithValue(ctx, auditSourceContextKey, src)
+}
+
+// AuditSourceFromContext returns the audit source stored by ContextWithAuditSource, or
+// an empty one for changes which aren't made by a request (background jobs).
+func AuditSourceFromContext(ctx context.Context) AuditSource {
+	src, _ := ctx.Value(auditSourceContextKey).(AuditSource)
+	return src
+}
+
+// ContextWithAuditActor returns a copy of ctx whose audit source has the actor set.
+func ContextWithAuditActor(ctx context.Context, actorID uuid.UUID) context.Context {
+	src := AuditSourceFromContext(ctx)
+	src.ActorID = actorID
+	return ContextWithAuditSource(ctx, src)
+}
+
+// ContextWithAuditOrganization returns a copy of ctx whose audit source has the
+// organization set.
+func ContextWithAuditOrganization(ctx context.Context, orgID uuid.UUID) context.Context {
+	src := AuditSourceFromContext(ctx)
+	src.OrganizationID = orgID
+	return ContextWithAuditSource(ctx, src)
+}
+
+type AuditModel struct {
+	DB        Conn
+	tableName string
+}
+
+func NewAuditModel(db *sqlx.DB) AuditModel {
+	return AuditModel{
+		DB:        Conn{pool: db},
+		tableName: "audit_events",
+	}
+}
+
+// Record writes an audit event for the change of the target from before to after,
+// within the transaction carried by ctx if any.
+func (m AuditModel) Record(ctx context.Context, action, targetType, targetID string, before, after interface{}) error {
+	changes, err := AuditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return m.Insert(ctx, &AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    changes,
+	})
+}
+
+// Insert records the audit event, which is written when the transaction carried by ctx
+// commits, or right away if there is none. The actor, organization, IP and request ID
+// are taken from the audit source in ctx unless already set.
+func (m AuditModel) Insert(ctx context.Context, event *AuditEvent) error {
+	return insertAuditEvent(ctx, m.DB, event)
+}
+
+func insertAuditEvent(ctx context.Context, db Conn, event *AuditEvent) error {
+	fillAuditSource(ctx, event)
+
+	// the event is chained to the last one as the transaction commits, not to hold the
+	// lock on the chain while the rest of it runs
+	return transaction(ctx, db, func(ctx context.Context) error {
+		event.AuditEventID = uuid.New()
+		recordAuditEvent(ctx, event)
+		return nil
+	})
+}
+
+// fillAuditSource sets the fields of the event taken from the audit source in ctx, unless
+// already set.
+func fillAuditSource(ctx context.Context, event *AuditEvent) {
+	src := AuditSourceFromContext(ctx)
+	if !event.ActorID.Valid && src.ActorID != uuid.Nil {
+		event.ActorID = uuid.NullUUID{UUID: src.ActorID, Valid: true}
+	}
+	if !event.OrganizationID.Valid && src.OrganizationID != uuid.Nil {
+		event.OrganizationID = uuid.NullUUID{UUID: src.OrganizationID, Valid: true}
+	}
+	if event.IP == "" {
+		event.IP = src.IP
+	}
+	if event.RequestID == "" {
+		event.RequestID = src.RequestID
+	}
+	if event.Changes == nil {
+		event.Changes = AuditChanges{}
+	}
+}
+
+func (m AuditModel) GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*AuditEvent, Metadata, error) {
+	p, err := filters.pagination("sequence")
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	base := goqu.From(m.tableName).Where(wheres...)
+
+	totalRecords := 0
+
+	if p.countSeparately() {
+		query, args, err := base.Select(goqu.COUNT("*")).ToSQL()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+	}
+
+	columns := auditEventColumns
+	if p.countOver() {
+		columns = append([]interface{}{goqu.COUNT("*").Over(goqu.W())}, columns...)
+	}
+
+	sel := base.Select(columns...).Order(p.order()...)
+
+	if where := p.where(); where != nil {
+		sel = sel.Where(where)
+	}
+
+	if p.paged() {
+		sel = sel.Limit(p.limit()).Offset(p.offset())
+	}
+
+	query, args, err := sel.ToSQL()
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	rows, err := conn(ctx, m.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	events := []*AuditEvent{}
+
+	for rows.Next() {
+		var event AuditEvent
+
+		dest := auditEventFields(&event)
+		if p.countOver() {
+			dest = append([]interface{}{&totalRecords}, dest...)
+		}
+
+		err := rows.Scan(dest...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		events = append(events, &event)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	n, metadata, err := p.finish(events, totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return events[:n], metadata, nil
+}
+
+// auditEventColumns are the columns scanned by auditEventFields.
+var auditEventColumns = []interface{}{
+	"audit_event_id", "sequence", "actor_id", "organization_id",
+	"action", "target_type", "target_id", "changes",
+	"ip", "request_id", "created_at", "prev_hash", "hash",
+}
+
+func auditEventFields(event *AuditEvent) []interface{} {
+	return []interface{}{
+		&event.AuditEventID,
+		&event.Sequence,
+		&event.ActorID,
+		&event.OrganizationID,
+		&event.Action,
+		&event.TargetType,
+		&event.TargetID,
+		&event.Changes,
+		&event.IP,
+		&event.RequestID,
+		&event.CreatedAt,
+		&event.PrevHash,
+		&event.Hash,
+	}
+}
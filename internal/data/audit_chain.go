@@ -0,0 +1,279 @@
+package data
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+)
+
+// auditChainLock is the key of the advisory lock which serializes appending to the
+// audit chain. It is held until the end of the transaction, so transactions writing
+// audit events commit one at a time. The events are only appended as the transaction
+// commits (see Commit), so the lock isn't held while the rest of the transaction runs,
+// like the handler of a request in the TenantTransaction middleware.
+const auditChainLock = 7_202_036
+
+// appendAuditEvents chains the events to the last one and inserts them: it assigns the
+// next sequence numbers, the creation times and the hashes. It must run in a
+// transaction, committed right after as the lock it takes is held until then.
+func appendAuditEvents(ctx context.Context, db DBTX, events []*AuditEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, auditChainLock)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := goqu.
+		Select("sequence", "hash").
+		From("audit_events").
+		Order(goqu.I("sequence").Desc()).
+		Limit(1).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	var last AuditEvent
+	err = db.QueryRowContext(ctx, query, args...).Scan(&last.Sequence, &last.Hash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	for _, event := range events {
+		event.Sequence = last.Sequence + 1
+		event.PrevHash = last.Hash
+		// postgres keeps microseconds, the hash has to match what is read back
+		event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+		event.Hash, err = event.ComputeHash()
+		if err != nil {
+			return err
+		}
+
+		err = insertChainedAuditEvent(ctx, db, event)
+		if err != nil {
+			return err
+		}
+
+		last = *event
+	}
+
+	return nil
+}
+
+func insertChainedAuditEvent(ctx context.Context, db DBTX, event *AuditEvent) error {
+	query, args, err := goqu.
+		Insert("audit_events").
+		Rows(goqu.Record{
+			"audit_event_id":  event.AuditEventID,
+			"sequence":        event.Sequence,
+			"actor_id":        event.ActorID,
+			"organization_id": event.OrganizationID,
+			"action":          event.Action,
+			"target_type":     event.TargetType,
+			"target_id":       event.TargetID,
+			"changes":         event.Changes,
+			"ip":              event.IP,
+			"request_id":      event.RequestID,
+			"created_at":      event.CreatedAt,
+			"prev_hash":       event.PrevHash,
+			"hash":            event.Hash,
+		}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// ComputeHash returns the hex encoded SHA-256 hash of the event's fields, including the
+// hash of the previous event in the chain.
+func (e *AuditEvent) ComputeHash() (string, error) {
+	// jsonb doesn't keep the formatting, so hash the changes as decoded from JSON
+	changes, err := canonicalJSON(e.Changes)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(struct {
+		AuditEventID   uuid.UUID       `json:"audit_event_id"`
+		Sequence       int64           `json:"sequence"`
+		ActorID        uuid.NullUUID   `json:"actor_id"`
+		OrganizationID uuid.NullUUID   `json:"organization_id"`
+		Action         string          `json:"action"`
+		TargetType     string          `json:"target_type"`
+		TargetID       string          `json:"target_id"`
+		Changes        json.RawMessage `json:"changes"`
+		IP             string          `json:"ip"`
+		RequestID      string          `json:"request_id"`
+		CreatedAt      string          `json:"created_at"`
+		PrevHash       string          `json:"prev_hash"`
+	}{
+		AuditEventID:   e.AuditEventID,
+		Sequence:       e.Sequence,
+		ActorID:        e.ActorID,
+		OrganizationID: e.OrganizationID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		Changes:        changes,
+		IP:             e.IP,
+		RequestID:      e.RequestID,
+		CreatedAt:      e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:       e.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func canonicalJSON(v interface{}) (json.RawMessage, error) {
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded interface{}
+	err = json.Unmarshal(js, &decoded)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(decoded)
+}
+
+// AuditChainBreak is an audit event which doesn't fit in the chain.
+type AuditChainBreak struct {
+	Sequence     int64     `json:"sequence"`
+	AuditEventID uuid.UUID `json:"audit_event_id"`
+	Reason       string    `json:"reason"`
+}
+
+func (b AuditChainBreak) String() string {
+	return fmt.Sprintf("#%d (%s): %s", b.Sequence, b.AuditEventID, b.Reason)
+}
+
+// CheckAuditLink checks that the event hasn't been altered and, unless prev is nil,
+// that it directly follows prev in the chain.
+func CheckAuditLink(prev, event *AuditEvent) ([]AuditChainBreak, error) {
+	breaks := []AuditChainBreak{}
+	broken := func(format string, args ...interface{}) {
+		breaks = append(breaks, AuditChainBreak{
+			Sequence:     event.Sequence,
+			AuditEventID: event.AuditEventID,
+			Reason:       fmt.Sprintf(format, args...),
+		})
+	}
+
+	hash, err := event.ComputeHash()
+	if err != nil {
+		return nil, err
+	}
+
+	if hash != event.Hash {
+		broken("hash doesn't match the contents of the record")
+	}
+
+	if prev != nil {
+		if event.Sequence != prev.Sequence+1 {
+			broken("records #%d to #%d are missing", prev.Sequence+1, event.Sequence-1)
+		}
+		if event.PrevHash != prev.Hash {
+			broken("previous hash doesn't match the hash of #%d", prev.Sequence)
+		}
+	}
+
+	return breaks, nil
+}
+
+// VerifyChain walks the whole audit chain and returns the events which were altered,
+// or follow removed events. It also returns the number of events checked.
+func (m AuditModel) VerifyChain(ctx context.Context) ([]AuditChainBreak, int, error) {
+	return verifyAuditChain(ctx, m.Each)
+}
+
+// verifyAuditChain checks the chain of the events walked through by each.
+func verifyAuditChain(ctx context.Context, each func(ctx context.Context, wheres []goqu.Expression, fn func(event *AuditEvent) error) error) ([]AuditChainBreak, int, error) {
+	breaks := []AuditChainBreak{}
+	count := 0
+
+	var prev *AuditEvent
+
+	err := each(ctx, nil, func(event *AuditEvent) error {
+		count++
+
+		if prev == nil && (event.Sequence != 1 || event.PrevHash != "") {
+			breaks = append(breaks, AuditChainBreak{
+				Sequence:     event.Sequence,
+				AuditEventID: event.AuditEventID,
+				Reason:       "the chain doesn't start with the first record",
+			})
+		}
+
+		b, err := CheckAuditLink(prev, event)
+		if err != nil {
+			return err
+		}
+
+		breaks = append(breaks, b...)
+		prev = event
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return breaks, count, nil
+}
+
+// Each calls fn with the audit events matching the conditions, in chain order. The
+// events are streamed from the database rather than loaded at once.
+func (m AuditModel) Each(ctx context.Context, wheres []goqu.Expression, fn func(event *AuditEvent) error) error {
+	query, args, err := goqu.
+		Select(auditEventColumns...).
+		From(m.tableName).
+		Where(wheres...).
+		Order(goqu.I("sequence").Asc()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	rows, err := conn(ctx, m.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var event AuditEvent
+
+		err := rows.Scan(auditEventFields(&event)...)
+		if err != nil {
+			return err
+		}
+
+		err = fn(&event)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
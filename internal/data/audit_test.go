@@ -0,0 +1,46 @@
+package data
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// The events recorded in a transaction are only chained as it commits, so the lock on
+// the chain isn't held while the rest of the transaction runs. The transaction here is
+// never used, as recording an event mustn't run any query.
+func TestInsertAuditEventInTransaction(t *testing.T) {
+	ctx := ContextWithTx(context.Background(), &sqlx.Tx{})
+	m := AuditModel{}
+
+	for _, action := range []string{AuditUserUpdate, AuditUserDelete} {
+		err := m.Insert(ctx, &AuditEvent{Action: action, TargetType: AuditTargetUser})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// joining the transaction records the events in it too
+	err := transaction(ctx, m.DB, func(ctx context.Context) error {
+		return m.Insert(ctx, &AuditEvent{Action: AuditUserRestore, TargetType: AuditTargetUser})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := ctx.Value(txContextKey).(*txState)
+	if len(s.audit) != 3 {
+		t.Fatalf("got %d recorded events, want 3", len(s.audit))
+	}
+
+	for _, event := range s.audit {
+		if event.AuditEventID == uuid.Nil {
+			t.Errorf("the %s event has no ID", event.Action)
+		}
+		if event.Sequence != 0 || event.Hash != "" {
+			t.Errorf("the %s event was chained before the transaction committed", event.Action)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package data
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// cursor is the position of a row in the order of a list, and the direction to page in
+// from there. It is handed out signed so clients can't forge positions.
+type cursor struct {
+	Sort   string        `json:"s"`
+	Values []interface{} `json:"v"`
+	Prev   bool          `json:"p,omitempty"`
+}
+
+func encodeCursor(key []byte, c cursor) (string, error) {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCursor(key []byte, token string) (cursor, error) {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(payload)
+
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	var c cursor
+
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	dec.UseNumber()
+
+	err = dec.Decode(&c)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+
+	for i, value := range c.Values {
+		if n, ok := value.(json.Number); ok {
+			if c.Values[i], err = n.Int64(); err != nil {
+				c.Values[i], _ = n.Float64()
+			}
+		}
+	}
+
+	return c, nil
+}
+
+// sortKey is a column the rows of a list are ordered by.
+type sortKey struct {
+	column     string
+	desc       bool
+	nullsFirst bool
+}
+
+// pagination is how a list query pages through its rows: by offset for page numbers,
+// or from the position of a cursor (keyset pagination), which doesn't slow down deep
+// into the list nor shift when rows are inserted. The rows are ordered by the sort
+// keys then by the tiebreaker, a unique column, so each row has its own position.
+type pagination struct {
+	filters Filters
+	keys    []sortKey
+	cursor  *cursor
+}
+
+func (f Filters) pagination(tiebreaker string) (pagination, error) {
+	keys, err := f.sortKeys()
+	if err != nil {
+		return pagination{}, err
+	}
+
+	p := pagination{filters: f, keys: keys}
+
+	if !f.SortsBy(tiebreaker) {
+		// in the direction of the last key, so a single key's order is simply reversed
+		desc := len(keys) > 0 && keys[len(keys)-1].desc
+		p.keys = append(p.keys, sortKey{column: tiebreaker, desc: desc, nullsFirst: desc})
+	}
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.CursorKey, f.Cursor)
+		if err != nil {
+			return pagination{}, err
+		}
+
+		if c.Sort != f.Sort || len(c.Values) != len(p.keys) {
+			return pagination{}, ErrInvalidCursor
+		}
+
+		p.cursor = &c
+	}
+
+	return p, nil
+}
+
+// paged reports whether the rows are split into pages at all.
+func (p pagination) paged() bool {
+	return p.filters.limit() > 0 && (p.filters.Page > 0 || p.cursor != nil)
+}
+
+// reversed reports whether the rows are fetched in reverse, to page backwards from a
+// cursor.
+func (p pagination) reversed() bool {
+	return p.cursor != nil && p.cursor.Prev
+}
+
+// fetchKeys returns the order to fetch the rows in.
+func (p pagination) fetchKeys() []sortKey {
+	keys := make([]sortKey, len(p.keys))
+	for i, key := range p.keys {
+		keys[i] = sortKey{
+			column:     key.column,
+			desc:       key.desc != p.reversed(),
+			nullsFirst: key.nullsFirst != p.reversed(),
+		}
+	}
+
+	return keys
+}
+
+func (p pagination) order() []exp.OrderedExpression {
+	order := []exp.OrderedExpression{}
+	for _, key := range p.fetchKeys() {
+		o := goqu.I(key.column).Asc()
+		if key.desc {
+			o = goqu.I(key.column).Desc()
+		}
+
+		// only when it isn't the default, which the indexes are built for
+		if key.nullsFirst != key.desc {
+			if key.nullsFirst {
+				o = o.NullsFirst()
+			} else {
+				o = o.NullsLast()
+			}
+		}
+
+		order = append(order, o)
+	}
+
+	return order
+}
+
+// where returns the condition for the rows coming after the cursor in the fetch order,
+// or nil without a cursor.
+func (p pagination) where() exp.Expression {
+	if p.cursor == nil {
+		return nil
+	}
+
+	after := []exp.Expression{}
+	equal := []exp.Expression{}
+
+	for i, key := range p.fetchKeys() {
+		col := goqu.I(key.column)
+		value := p.cursor.Values[i]
+
+		var next exp.Expression
+		switch {
+		case value == nil && key.nullsFirst:
+			next = col.IsNotNull()
+		case value == nil:
+			// nothing comes after the NULLs
+		default:
+			next = col.Gt(value)
+			if key.desc {
+				next = col.Lt(value)
+			}
+			if !key.nullsFirst {
+				next = goqu.Or(next, col.IsNull())
+			}
+		}
+
+		if next != nil {
+			after = append(after, goqu.And(append(append([]exp.Expression{}, equal...), next)...))
+		}
+
+		if value == nil {
+			equal = append(equal, col.IsNull())
+		} else {
+			equal = append(equal, col.Eq(value))
+		}
+	}
+
+	return goqu.Or(after...)
+}
+
+// columns returns the columns to fetch out of all of them: those of Fields, along with
+// the sort keys the cursors are made of.
+func (p pagination) columns(all []string) []string {
+	if len(p.filters.Fields) == 0 {
+		return all
+	}
+
+	columns := []string{}
+	for _, column := range all {
+		fetch := false
+		for _, field := range p.filters.Fields {
+			fetch = fetch || field == column
+		}
+		for _, key := range p.keys {
+			fetch = fetch || key.column == column
+		}
+
+		if fetch {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+// limit returns how many rows to fetch: one more than the page size, which tells
+// whether there is a next page.
+func (p pagination) limit() uint {
+	return uint(p.filters.limit()) + 1
+}
+
+func (p pagination) offset() uint {
+	if p.cursor != nil {
+		return 0
+	}
+
+	return uint(p.filters.offset())
+}
+
+// countOver reports whether the records are counted along with the rows, by a window
+// function. Past a cursor the count has to be made separately (see countSeparately),
+// as the condition of the cursor leaves rows out.
+func (p pagination) countOver() bool {
+	return p.cursor == nil && !p.filters.SkipCount
+}
+
+func (p pagination) countSeparately() bool {
+	return p.cursor != nil && !p.filters.SkipCount
+}
+
+// finish takes the records (a slice) fetched with the pagination, and returns how many
+// of them are on the page along with the metadata. The records fetched in reverse are
+// put back in order.
+func (p pagination) finish(records interface{}, totalRecords int) (int, Metadata, error) {
+	v := reflect.ValueOf(records)
+
+	n := v.Len()
+	more := p.paged() && n > p.filters.limit()
+	if more {
+		n = p.filters.limit()
+	}
+
+	if p.reversed() {
+		swap := reflect.Swapper(records)
+		for i, j := 0, n-1; i < j; i, j = i+1, j-1 {
+			swap(i, j)
+		}
+	}
+
+	var metadata Metadata
+	switch {
+	case p.filters.SkipCount:
+		metadata = Metadata{PageSize: p.filters.PageSize}
+		if p.cursor == nil {
+			metadata.CurrentPage, metadata.FirstPage = p.filters.Page, 1
+		}
+	case p.cursor != nil:
+		metadata = Metadata{PageSize: p.filters.PageSize, TotalRecords: totalRecords}
+	default:
+		metadata = calculateMetadata(totalRecords, p.filters.Page, p.filters.PageSize)
+	}
+
+	if n == 0 || !p.paged() {
+		return n, metadata, nil
+	}
+
+	hasNext, hasPrev := more, p.cursor != nil || p.filters.Page > 1
+	if p.reversed() {
+		hasNext, hasPrev = true, more
+	}
+
+	var err error
+
+	if hasNext {
+		metadata.NextCursor, err = p.cursorAt(v.Index(n-1).Interface(), false)
+		if err != nil {
+			return 0, Metadata{}, err
+		}
+	}
+
+	if hasPrev {
+		metadata.PrevCursor, err = p.cursorAt(v.Index(0).Interface(), true)
+		if err != nil {
+			return 0, Metadata{}, err
+		}
+	}
+
+	return n, metadata, nil
+}
+
+// cursorAt returns the cursor of the pages after or before the record.
+func (p pagination) cursorAt(record interface{}, prev bool) (string, error) {
+	row := rowValues(record)
+
+	values := make([]interface{}, len(p.keys))
+	for i, key := range p.keys {
+		values[i] = row[key.column]
+	}
+
+	return encodeCursor(p.filters.CursorKey, cursor{Sort: p.filters.Sort, Values: values, Prev: prev})
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// DBTX is what the models need to run queries, implemented by both *sqlx.DB and
+// *sqlx.Tx.
+type DBTX interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// Conn is what a model runs its queries on: the connection pool, unless the context
+// carries a transaction (see Models.Transaction).
+type Conn struct {
+	pool *sqlx.DB
+	// the replicas the read-only queries may run on instead of the pool
+	replicas *Replicas
+}
+
+type contextKey string
+
+const txContextKey = contextKey("tx")
+
+// txState is what ContextWithTx stores: the transaction, and the audit events recorded
+// in it, which are appended to the audit chain when it is committed (see Commit).
+type txState struct {
+	tx *sqlx.Tx
+
+	mu    sync.Mutex
+	audit []*AuditEvent
+}
+
+// ContextWithTx returns a copy of ctx carrying the transaction. Every model query made
+// with the returned context runs in that transaction instead of on the pool. The
+// transaction has to be committed with Commit.
+func ContextWithTx(ctx context.Context, tx *sqlx.Tx) context.Context {
+	return context.WithValue(ctx, txContextKey, &txState{tx: tx})
+}
+
+// TxFromContext returns the transaction stored by ContextWithTx, if any.
+func TxFromContext(ctx context.Context) (*sqlx.Tx, bool) {
+	tx := currentTx(ctx)
+	return tx, tx != nil
+}
+
+// ContextWithoutTx returns a copy of ctx whose model queries run on the pool even if
+// ctx carries a transaction, for writes which must
+// persist when the transaction is rolled back (like failed login attempts).
+func ContextWithoutTx(ctx context.Context) context.Context {
+	return context.WithValue(ctx, txContextKey, (*txState)(nil))
+}
+
+// Commit appends the audit events recorded in the transaction carried by ctx to the
+// audit chain, then commits the transaction. Appending takes the lock serializing the
+// chain (see auditChainLock), which is held until the commit, so it is left for last.
+func Commit(ctx context.Context) error {
+	s, _ := ctx.Value(txContextKey).(*txState)
+	if s == nil || s.tx == nil {
+		return errors.New("data: no transaction to commit")
+	}
+
+	s.mu.Lock()
+	events := s.audit
+	s.audit = nil
+	s.mu.Unlock()
+
+	err := appendAuditEvents(ctx, s.tx, events)
+	if err != nil {
+		return err
+	}
+
+	return s.tx.Commit()
+}
+
+// maxTxAttempts is how many times a transaction is run before giving up on deadlocks
+// and serialization failures.
+const maxTxAttempts = 3
+
+// Transaction runs fn with a context carrying a new transaction, which is committed if
+// fn returns nil and rolled back otherwise. If ctx already carries a transaction, fn
+// runs in it and committing is left to whoever started it. The errors of PostgreSQL are translated (see translateError).
+//
+// A new transaction runs at READ COMMITTED, the default of PostgreSQL, so the concurrent
+// updates are caught by the version columns rather than by serialization failures,
+// which practically only happen at REPEATABLE READ or SERIALIZABLE. What is retried, so
+// fn may run more than once, is a transaction chosen as the victim of a deadlock, or one
+// failing to serialize after fn raised its isolation level with SET TRANSACTION.
+// Transactions aren't begun at a stricter level as their snapshot would be taken before
+// the locks they acquire, like the one appending to the audit chain.
+func (m Models) Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if m.memory != nil {
+		return m.memory.transaction(ctx, fn)
+	}
+
+	return transaction(ctx, Conn{pool: m.DB}, fn)
+}
+
+// WithReplicas returns a copy of the models running their read-only queries on the
+// replicas (see Replicas).
+func (m Models) WithReplicas(replicas *Replicas) Models {
+	m.Replicas = replicas
+
+	return m.eachConn(func(c *Conn) { c.replicas = replicas })
+}
+
+// eachConn applies fn to the Conn of each model. The repositories which aren't models
+// (the in-memory ones) are left as they are.
+func (m Models) eachConn(fn func(c *Conn)) Models {
+	if users, ok := m.Users.(UserModel); ok {
+		fn(&users.DB)
+		m.Users = users
+	}
+	if tokens, ok := m.Tokens.(TokenModel); ok {
+		fn(&tokens.DB)
+		m.Tokens = tokens
+	}
+	if permissions, ok := m.Permissions.(PermissionModel); ok {
+		fn(&permissions.DB)
+		m.Permissions = permissions
+	}
+	if roles, ok := m.Roles.(RoleModel); ok {
+		fn(&roles.DB)
+		m.Roles = roles
+	}
+	if orgs, ok := m.Organizations.(OrganizationModel); ok {
+		fn(&orgs.DB)
+		m.Organizations = orgs
+	}
+	if groups, ok := m.Groups.(GroupModel); ok {
+		fn(&groups.DB)
+		m.Groups = groups
+	}
+	if audit, ok := m.Audit.(AuditModel); ok {
+		fn(&audit.DB)
+		m.Audit = audit
+	}
+	if exports, ok := m.Exports.(ExportModel); ok {
+		fn(&exports.DB)
+		m.Exports = exports
+	}
+
+	return m
+}
+
+func transaction(ctx context.Context, db Conn, fn func(ctx context.Context) error) error {
+	if currentTx(ctx) != nil {
+		return fn(ctx)
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := runTransaction(ctx, db.pool, fn)
+		if err == nil || attempt == maxTxAttempts || !isSerializationFailure(err) {
+			return translateError(err)
+		}
+
+		// give the conflicting transaction time to finish
+		select {
+		case <-time.After(time.Duration(attempt) * 20 * time.Millisecond):
+		case <-ctx.Done():
+			return translateError(err)
+		}
+	}
+}
+
+func runTransaction(ctx context.Context, db *sqlx.DB, fn func(ctx context.Context) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// a no-op once the transaction has been committed
+	defer tx.Rollback()
+
+	ctx = ContextWithTx(ctx, tx)
+
+	err = fn(ctx)
+	if err != nil {
+		return err
+	}
+
+	return Commit(ctx)
+}
+
+// isSerializationFailure reports whether the transaction failed because of a
+// concurrent one, on a deadlock or a serialization failure, and may succeed if run
+// again.
+func isSerializationFailure(err error) bool {
+	return errors.Is(translateError(err), ErrSerializationFailure)
+}
+
+// currentTx returns the transaction carried by ctx, or nil if the queries made with
+// ctx should run on the pool.
+func currentTx(ctx context.Context) *sqlx.Tx {
+	s, _ := ctx.Value(txContextKey).(*txState)
+	if s == nil {
+		return nil
+	}
+
+	return s.tx
+}
+
+// recordAuditEvent adds the event to those appended to the audit chain when the
+// transaction carried by ctx is committed. ctx must carry a transaction.
+func recordAuditEvent(ctx context.Context, event *AuditEvent) {
+	s := ctx.Value(txContextKey).(*txState)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, event)
+}
+
+// conn returns the transaction queries made with ctx should run in, or the pool if
+// there is none.
+func conn(ctx context.Context, db Conn) DBTX {
+	if tx := currentTx(ctx); tx != nil {
+		return tx
+	}
+
+	return db.pool
+}
+
+// SetSessionTenant sets the app.current_tenant and app.current_user settings used by
+// the row level security policies, and turns app.bypass_rls off, for the rest of the
+// transaction carried by ctx so it only sees the rows of the tenant. It does nothing if
+// ctx doesn't carry a transaction. Pass uuid.Nil to leave a setting empty, which the
+// policies match no row against.
+func SetSessionTenant(ctx context.Context, tenantID, userID uuid.UUID) error {
+	return setSession(ctx, tenantID, userID, false)
+}
+
+// SetSessionGlobal turns app.bypass_rls on and sets app.current_user for the rest of
+// the transaction carried by ctx, for the requests which aren't scoped to a tenant and
+// so see the rows of all of them. It does nothing if ctx doesn't carry a transaction.
+func SetSessionGlobal(ctx context.Context, userID uuid.UUID) error {
+	return setSession(ctx, uuid.Nil, userID, true)
+}
+
+func setSession(ctx context.Context, tenantID, userID uuid.UUID, bypass bool) error {
+	tx, ok := TxFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	bypassValue := "off"
+	if bypass {
+		bypassValue = "on"
+	}
+
+	_, err := tx.ExecContext(ctx,
+		`SELECT set_config('app.current_tenant', $1, true), set_config('app.current_user', $2, true),
+		set_config('app.bypass_rls', $3, true)`,
+		settingValue(tenantID), settingValue(userID), bypassValue,
+	)
+	return err
+}
+
+// BypassRLSDSN returns the DSN with app.bypass_rls turned on for the whole session of
+// its connections, which lib/pq sends to the server as a run-time parameter. The row
+// level security policies fail closed, so the pools of the api, the CLIs and the
+// migrations connect with it, and the transactions of the requests within an
+// organization turn it off (see SetSessionTenant).
+func BypassRLSDSN(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "app.bypass_rls=on"
+	}
+
+	return dsn + " app.bypass_rls=on"
+}
+
+func settingValue(id uuid.UUID) string {
+	if id == uuid.Nil {
+		return ""
+	}
+
+	return id.String()
+}
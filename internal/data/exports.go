@@ -0,0 +1,169 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Statuses of a data export.
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, assembled in the
+// background when they request it.
+type DataExport struct {
+	ExportID  uuid.UUID `json:"export_id" db:"export_id"`
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Status    string    `json:"status" db:"status"`
+	Content   []byte    `json:"-" db:"content"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt null.Time `json:"expires_at" db:"expires_at"`
+}
+
+type ExportModel struct {
+	DB        Conn
+	tableName string
+}
+
+func NewExportModel(db *sqlx.DB) ExportModel {
+	return ExportModel{
+		DB:        Conn{pool: db},
+		tableName: "data_exports",
+	}
+}
+
+// Insert adds a pending export.
+func (m ExportModel) Insert(ctx context.Context, export *DataExport) error {
+	query, args, err := goqu.
+		Insert(m.tableName).
+		Rows(goqu.Record{
+			"user_id": export.UserID,
+			"status":  ExportPending,
+		}).
+		Returning("export_id", "status", "created_at").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	return conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&export.ExportID, &export.Status, &export.CreatedAt)
+}
+
+// Complete stores the content of the export and marks it as ready until the expiry. It
+// returns ErrRecordNotFound if the export doesn't exist (anymore).
+func (m ExportModel) Complete(ctx context.Context, export *DataExport) error {
+	// prepared, as the archive can't be interpolated into the query
+	query, args, err := goqu.
+		Update(m.tableName).
+		Prepared(true).
+		Set(goqu.Record{
+			"status":     ExportReady,
+			"content":    export.Content,
+			"expires_at": export.ExpiresAt,
+		}).
+		Where(goqu.Ex{"export_id": export.ExportID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	export.Status = ExportReady
+	return nil
+}
+
+// Fail marks the export as failed. It returns ErrRecordNotFound if the export doesn't
+// exist (anymore).
+func (m ExportModel) Fail(ctx context.Context, export *DataExport) error {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{"status": ExportFailed}).
+		Where(goqu.Ex{"export_id": export.ExportID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	export.Status = ExportFailed
+	return nil
+}
+
+// GetLatestForUser returns the most recent ready and unexpired export of the user.
+func (m ExportModel) GetLatestForUser(ctx context.Context, userID uuid.UUID) (*DataExport, error) {
+	query, args, err := goqu.
+		Select("export_id", "user_id", "status", "content", "created_at", "expires_at").
+		From(m.tableName).
+		Where(
+			goqu.Ex{"user_id": userID, "status": ExportReady},
+			goqu.I("expires_at").Gt(goqu.L("NOW()")),
+		).
+		Order(goqu.I("created_at").Desc()).
+		Limit(1).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var export DataExport
+	err = conn(ctx, m.DB).GetContext(ctx, &export, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &export, nil
+}
+
+func (m ExportModel) DeleteAllForUser(ctx context.Context, userID uuid.UUID) error {
+	query, args, err := goqu.
+		Delete(m.tableName).
+		Where(goqu.Ex{"user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	return err
+}
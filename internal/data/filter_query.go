@@ -0,0 +1,213 @@
+package data
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+)
+
+// Types of the values of a filter field.
+const (
+	FilterString = "string"
+	FilterBool   = "bool"
+	FilterInt    = "int"
+	FilterUUID   = "uuid"
+	FilterTime   = "time"
+)
+
+// Filter operators. The value of "in" is a comma separated list, and the one of
+// "is_null" a boolean.
+const (
+	FilterEq     = "eq"
+	FilterNe     = "ne"
+	FilterLt     = "lt"
+	FilterLte    = "lte"
+	FilterGt     = "gt"
+	FilterGte    = "gte"
+	FilterLike   = "like"
+	FilterILike  = "ilike"
+	FilterIn     = "in"
+	FilterIsNull = "is_null"
+)
+
+// The operators usually allowed on the fields of each type. Nullable fields add
+// FilterIsNull.
+var (
+	StringFilterOperators = []string{FilterEq, FilterNe, FilterLike, FilterILike, FilterIn}
+	BoolFilterOperators   = []string{FilterEq}
+	IntFilterOperators    = []string{FilterEq, FilterNe, FilterLt, FilterLte, FilterGt, FilterGte, FilterIn}
+	UUIDFilterOperators   = []string{FilterEq, FilterNe, FilterIn}
+	TimeFilterOperators   = []string{FilterLt, FilterLte, FilterGt, FilterGte}
+)
+
+// FilterField is a field a list can be filtered on, with the operators allowed on it.
+// Column defaults to the name of the field.
+type FilterField struct {
+	Column    string
+	Type      string
+	Operators []string
+}
+
+// FilterSafelist is the fields a list can be filtered on, by name.
+type FilterSafelist map[string]FilterField
+
+// filterKeyRX matches "filter[field][op]", "filter[field]", "field[op]" and "field".
+var filterKeyRX = regexp.MustCompile(`^(?:filter\[([a-z_]+)\]|([a-z_]+))(?:\[([a-z_]+)\])?$`)
+
+// ParseFilterQuery compiles the filters of the query string into conditions for
+// GetAll. A filter is written filter[field][op]=value or field[op]=value, and the
+// operator defaults to eq, so first_name=Jane works as well. Parameters which aren't
+// fields of the safelist, like page or sort, are left alone unless they are written as
+// filters.
+func ParseFilterQuery(v *validator.Validator, qs url.Values, safelist FilterSafelist) []goqu.Expression {
+	keys := make([]string, 0, len(qs))
+	for key := range qs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	wheres := []goqu.Expression{}
+
+	for _, key := range keys {
+		m := filterKeyRX.FindStringSubmatch(key)
+		if m == nil {
+			if strings.HasPrefix(key, "filter[") {
+				v.AddError(key, "invalid filter")
+			}
+			continue
+		}
+
+		name, op := m[1]+m[2], m[3]
+		explicit := m[1] != "" || op != ""
+
+		field, ok := safelist[name]
+		if !ok {
+			if explicit {
+				v.AddError(key, "unknown filter field")
+			}
+			continue
+		}
+
+		if op == "" {
+			op = FilterEq
+		}
+
+		if !validator.In(op, field.Operators...) {
+			v.AddError(key, "unsupported filter operator")
+			continue
+		}
+
+		column := field.Column
+		if column == "" {
+			column = name
+		}
+
+		for _, s := range qs[key] {
+			// the plain parameters were ignored when empty
+			if s == "" && !explicit {
+				continue
+			}
+
+			where, err := compileFilter(column, field.Type, op, s)
+			if err != nil {
+				v.AddError(key, err.Error())
+				break
+			}
+
+			wheres = append(wheres, where)
+		}
+	}
+
+	return wheres
+}
+
+func compileFilter(column, typ, op, s string) (goqu.Expression, error) {
+	col := goqu.I(column)
+
+	switch op {
+	case FilterIsNull:
+		isNull, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		if isNull {
+			return col.IsNull(), nil
+		}
+		return col.IsNotNull(), nil
+	case FilterIn:
+		values := []interface{}{}
+		for _, item := range strings.Split(s, ",") {
+			value, err := parseFilterValue(typ, item)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return col.In(values), nil
+	}
+
+	value, err := parseFilterValue(typ, s)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op {
+	case FilterEq:
+		return col.Eq(value), nil
+	case FilterNe:
+		return col.Neq(value), nil
+	case FilterLt:
+		return col.Lt(value), nil
+	case FilterLte:
+		return col.Lte(value), nil
+	case FilterGt:
+		return col.Gt(value), nil
+	case FilterGte:
+		return col.Gte(value), nil
+	case FilterLike:
+		return col.Like(value), nil
+	case FilterILike:
+		return col.ILike(value), nil
+	}
+
+	return nil, errors.New("unsupported filter operator")
+}
+
+func parseFilterValue(typ, s string) (interface{}, error) {
+	switch typ {
+	case FilterBool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return nil, errors.New("must be true or false")
+		}
+		return b, nil
+	case FilterInt:
+		i, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, errors.New("must be an integer")
+		}
+		return i, nil
+	case FilterUUID:
+		id, err := uuid.Parse(s)
+		if err != nil {
+			return nil, errors.New("must be a valid UUID")
+		}
+		return id, nil
+	case FilterTime:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return nil, errors.New("must be a valid RFC 3339 time")
+		}
+		return t, nil
+	}
+
+	return s, nil
+}
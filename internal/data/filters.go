@@ -1,40 +1,108 @@
 package data
 
 import (
+	"errors"
 	"math"
 	"strings"
 
 	"github.com/hasahmad/go-skeleton/internal/validator"
 )
 
+var ErrInvalidSort = errors.New("invalid sort")
+
 type Filters struct {
-	Page         int
-	PageSize     int
+	Page     int
+	PageSize int
+	// comma separated columns, see sortKeys
 	Sort         string
 	SortSafelist []string
+	// the token of the page to return, from the next_cursor or prev_cursor of a
+	// previous response. It replaces Page when set.
+	Cursor string
+	// the key signing the cursors
+	CursorKey []byte
+	// leave the total number of records out of the metadata, which saves counting them
+	SkipCount bool
+	// the text to search for, for the lists supporting it
+	Search string
+	// the columns to fetch, all of them when empty
+	Fields []string
+}
+
+// maxSortKeys is how many columns a list can be sorted by at once.
+const maxSortKeys = 5
+
+// sortKeys parses Sort, a comma separated list of columns each optionally prefixed by
+// "-" for a descending order and suffixed by ":nulls_first" or ":nulls_last". By default
+// NULLs come last in ascending order and first in descending order, as in PostgreSQL.
+// Each column, with its direction, must be in the safelist. It returns ErrInvalidSort
+// otherwise.
+func (f Filters) sortKeys() ([]sortKey, error) {
+	if f.Sort == "" {
+		return nil, nil
+	}
+
+	keys := []sortKey{}
+	seen := map[string]bool{}
+
+	for _, s := range strings.Split(f.Sort, ",") {
+		key := sortKey{}
+
+		s, nulls, _ := cutString(s, ":")
+
+		if !validator.In(s, f.SortSafelist...) {
+			return nil, ErrInvalidSort
+		}
+
+		key.desc = strings.HasPrefix(s, "-")
+		key.column = strings.TrimPrefix(s, "-")
+
+		switch nulls {
+		case "":
+			key.nullsFirst = key.desc
+		case "nulls_first":
+			key.nullsFirst = true
+		case "nulls_last":
+			key.nullsFirst = false
+		default:
+			return nil, ErrInvalidSort
+		}
+
+		if seen[key.column] {
+			return nil, ErrInvalidSort
+		}
+		seen[key.column] = true
+
+		keys = append(keys, key)
+	}
+
+	if len(keys) > maxSortKeys {
+		return nil, ErrInvalidSort
+	}
+
+	return keys, nil
 }
 
-// Check that the client-provided Sort field matches one of the entries in our safelist
-// and if it does, extract the column name from the Sort field by stripping the leading
-// hyphen character (if one exists).
-func (f Filters) sortColumn() string {
-	for _, safeValue := range f.SortSafelist {
-		if f.Sort == safeValue {
-			return strings.TrimPrefix(f.Sort, "-")
+// SortsBy reports whether the column is one of the sort keys.
+func (f Filters) SortsBy(column string) bool {
+	keys, _ := f.sortKeys()
+	for _, key := range keys {
+		if key.column == column {
+			return true
 		}
 	}
 
-	panic("unsafe sort parameter: " + f.Sort)
+	return false
 }
 
-// Return the sort direction ("ASC" or "DESC") depending on the prefix character of the
-// Sort field.
-func (f Filters) sortDirection() string {
-	if strings.HasPrefix(f.Sort, "-") {
-		return "DESC"
+// cutString slices s around the first instance of sep (strings.Cut of later Go
+// versions).
+func cutString(s, sep string) (string, string, bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
 	}
 
-	return "ASC"
+	return s, "", false
 }
 
 func (f Filters) limit() int {
@@ -52,8 +120,15 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize > 0, "page_size", "must be greater than zero")
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
-	// Check that the sort parameter matches a value in the safelist.
-	v.Check(validator.In(f.Sort, f.SortSafelist...), "sort", "invalid sort value")
+	// Check that the sort parameter only has columns of the safelist.
+	_, err := f.sortKeys()
+	v.Check(err == nil, "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		c, err := decodeCursor(f.CursorKey, f.Cursor)
+		v.Check(err == nil, "cursor", "invalid cursor")
+		v.Check(err != nil || c.Sort == f.Sort, "cursor", "was made for another sort")
+	}
 }
 
 type Metadata struct {
@@ -62,6 +137,12 @@ type Metadata struct {
 	FirstPage    int `json:"first_page,omitempty"`
 	LastPage     int `json:"last_page,omitempty"`
 	TotalRecords int `json:"total_records,omitempty"`
+	// the cursors of the pages around this one, and the links to them set by the
+	// handlers
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+	Next       string `json:"next,omitempty"`
+	Prev       string `json:"prev,omitempty"`
 }
 
 // The calculateMetadata() function calculates the appropriate pagination metadata
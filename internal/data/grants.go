@@ -0,0 +1,89 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"gopkg.in/guregu/null.v4"
+)
+
+// Grant describes when a role or permission granted directly to a user is active and
+// why it was granted. A zero ValidFrom means now and an invalid ValidUntil means
+// forever.
+type Grant struct {
+	ValidFrom  time.Time
+	ValidUntil null.Time
+	Reason     string
+}
+
+func ValidateGrant(v *validator.Validator, grant Grant) {
+	if grant.ValidUntil.Valid {
+		v.Check(grant.ValidUntil.Time.After(time.Now()), "valid_until", "must be in the future")
+		v.Check(grant.ValidFrom.IsZero() || grant.ValidUntil.Time.After(grant.ValidFrom), "valid_until", "must be after valid_from")
+	}
+	v.Check(len(grant.Reason) <= 500, "reason", "must not be more than 500 bytes long")
+}
+
+// ExpiredGrant is a grant removed by the sweeper.
+type ExpiredGrant struct {
+	UserID     uuid.UUID `json:"user_id" db:"user_id"`
+	Code       string    `json:"code" db:"code"`
+	ValidUntil time.Time `json:"valid_until" db:"valid_until"`
+	Reason     string    `json:"reason" db:"reason"`
+}
+
+// grantRecord returns the grant columns of a users_roles or users_permissions row.
+func grantRecord(grant Grant) goqu.Record {
+	validFrom := grant.ValidFrom
+	if validFrom.IsZero() {
+		validFrom = time.Now()
+	}
+
+	return goqu.Record{
+		"valid_from":  validFrom,
+		"valid_until": grant.ValidUntil,
+		"reason":      grant.Reason,
+	}
+}
+
+// activeGrant is the condition for a users_roles or users_permissions row (with the
+// given alias) being currently active.
+func activeGrant(alias string) exp.Expression {
+	return goqu.And(
+		goqu.I(alias+".valid_from").Lte(goqu.L("NOW()")),
+		goqu.Or(
+			goqu.I(alias+".valid_until").IsNull(),
+			goqu.I(alias+".valid_until").Gt(goqu.L("NOW()")),
+		),
+	)
+}
+
+// auditExpiredGrants writes an audit event for each of the expired role or permission
+// grants.
+func auditExpiredGrants(ctx context.Context, db Conn, field string, grants []ExpiredGrant) error {
+	for _, grant := range grants {
+		err := insertAuditEvent(ctx, db, expiredGrantEvent(field, grant))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func expiredGrantEvent(field string, grant ExpiredGrant) *AuditEvent {
+	return &AuditEvent{
+		Action:     AuditGrantExpire,
+		TargetType: AuditTargetUser,
+		TargetID:   grant.UserID.String(),
+		Changes: AuditChanges{
+			field:         {Before: grant.Code},
+			"valid_until": {Before: grant.ValidUntil},
+			"reason":      {Before: grant.Reason},
+		},
+	}
+}
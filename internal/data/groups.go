@@ -0,0 +1,338 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	ErrDuplicateGroupName = errors.New("duplicate group name")
+)
+
+// Group is a set of users sharing the roles and permissions granted to the group.
+type Group struct {
+	TimeStampsModel
+	GroupID     uuid.UUID   `json:"group_id" db:"group_id"`
+	Name        string      `json:"name" db:"name"`
+	Roles       Roles       `json:"roles" db:"-"`
+	Permissions Permissions `json:"permissions" db:"-"`
+	Version     int         `json:"-" db:"version"`
+}
+
+func ValidateGroup(v *validator.Validator, group *Group) {
+	v.Check(group.Name != "", "name", "must be provided")
+	v.Check(len(group.Name) <= 150, "name", "must not be more than 150 bytes long")
+	v.Check(validator.Unique(group.Roles), "roles", "must not contain duplicate values")
+	v.Check(validator.Unique(group.Permissions), "permissions", "must not contain duplicate values")
+}
+
+type GroupModel struct {
+	DB        Conn
+	tableName string
+}
+
+func NewGroupModel(db *sqlx.DB) GroupModel {
+	return GroupModel{
+		DB:        Conn{pool: db},
+		tableName: "groups",
+	}
+}
+
+func (m GroupModel) Insert(ctx context.Context, group *Group) error {
+	query, args, err := goqu.
+		Insert(m.tableName).
+		Rows(map[string]interface{}{
+			"created_at": time.Now(),
+			"updated_at": time.Now(),
+			"name":       group.Name,
+		}).
+		Returning("group_id", "created_at", "updated_at", "version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&group.GroupID, &group.CreatedAt, &group.UpdatedAt, &group.Version)
+	if err != nil {
+		return translateError(err)
+	}
+
+	return m.SetAccess(ctx, group.GroupID, group.Roles, group.Permissions)
+}
+
+// Get returns the group along with its roles and permissions.
+func (m GroupModel) Get(ctx context.Context, id uuid.UUID) (*Group, error) {
+	query, args, err := goqu.
+		Select("group_id", "name", "created_at", "updated_at", "version").
+		From(m.tableName).
+		Where(goqu.Ex{"group_id": id}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var group Group
+	err = conn(ctx, m.DB).GetContext(ctx, &group, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	group.Roles = Roles{}
+	err = m.getCodes(ctx, &group.Roles, "roles", "role_id", "groups_roles", id)
+	if err != nil {
+		return nil, err
+	}
+
+	group.Permissions = Permissions{}
+	err = m.getCodes(ctx, &group.Permissions, "permissions", "permission_id", "groups_permissions", id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &group, nil
+}
+
+// GetAll returns all groups, without their roles and permissions.
+func (m GroupModel) GetAll(ctx context.Context) ([]*Group, error) {
+	query, args, err := goqu.
+		Select("group_id", "name", "created_at", "updated_at", "version").
+		From(m.tableName).
+		Order(goqu.I("name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*Group{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &groups, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return groups, nil
+}
+
+func (m GroupModel) Update(ctx context.Context, group *Group) error {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"name":       group.Name,
+			"version":    group.Version + 1,
+			"updated_at": time.Now(),
+		}).
+		Where(goqu.Ex{
+			"group_id": group.GroupID,
+			"version":  group.Version,
+		}).
+		Returning("version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&group.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return translateError(err)
+		}
+	}
+
+	return nil
+}
+
+func (m GroupModel) Delete(ctx context.Context, id uuid.UUID) error {
+	query, args, err := goqu.
+		Delete(m.tableName).
+		Where(goqu.Ex{"group_id": id}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// SetAccess replaces the roles and permissions granted to the group. Unknown codes are
+// ignored.
+func (m GroupModel) SetAccess(ctx context.Context, groupID uuid.UUID, roles Roles, permissions Permissions) error {
+	for _, table := range []string{"groups_roles", "groups_permissions"} {
+		query, args, err := goqu.
+			Delete(table).
+			Where(goqu.Ex{"group_id": groupID}).
+			ToSQL()
+		if err != nil {
+			return err
+		}
+
+		_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(roles) > 0 {
+		query, args, err := goqu.
+			Insert("groups_roles").
+			FromQuery(goqu.
+				Select(goqu.V(groupID).As("group_id"), goqu.I("roles.role_id").As("role_id")).
+				From("roles").
+				Where(goqu.L("roles.code = ?", goqu.Any(pq.Array(roles))))).
+			ToSQL()
+		if err != nil {
+			return err
+		}
+
+		_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(permissions) > 0 {
+		query, args, err := goqu.
+			Insert("groups_permissions").
+			FromQuery(goqu.
+				Select(goqu.V(groupID).As("group_id"), goqu.I("permissions.permission_id").As("permission_id")).
+				From("permissions").
+				Where(goqu.L("permissions.code = ?", goqu.Any(pq.Array(permissions))))).
+			ToSQL()
+		if err != nil {
+			return err
+		}
+
+		_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetMemberIDs returns the ids of the users in the group.
+func (m GroupModel) GetMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	query, args, err := goqu.
+		Select("user_id").
+		From("groups_users").
+		Where(goqu.Ex{"group_id": groupID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []uuid.UUID{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &userIDs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return userIDs, nil
+}
+
+// AddMembers adds the users to the group. Users who already are members are skipped.
+// It returns ErrRecordNotFound if one of the users doesn't exist.
+func (m GroupModel) AddMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+
+	rows := make([]interface{}, len(userIDs))
+	for i := range userIDs {
+		rows[i] = goqu.Record{"group_id": groupID, "user_id": userIDs[i]}
+	}
+
+	query, args, err := goqu.
+		Insert("groups_users").
+		Rows(rows...).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case isViolation(err, ConstraintForeignKey):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemoveMembers removes the users from the group.
+func (m GroupModel) RemoveMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error {
+	query, args, err := goqu.
+		Delete("groups_users").
+		Where(goqu.Ex{"group_id": groupID, "user_id": userIDs}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// getCodes loads the codes of the roles or permissions granted to the group through
+// the join table.
+func (m GroupModel) getCodes(ctx context.Context, dest interface{}, table, key, joinTable string, groupID uuid.UUID) error {
+	query, args, err := goqu.
+		Select(goqu.I("t.code")).
+		From(goqu.T(table).As("t")).
+		Join(goqu.T(joinTable).As("j"), goqu.On(goqu.I("j."+key).Eq(goqu.I("t."+key)))).
+		Where(goqu.Ex{"j.group_id": groupID}).
+		Order(goqu.I("t.code").Asc()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	return conn(ctx, m.DB).SelectContext(ctx, dest, query, args...)
+}
@@ -0,0 +1,514 @@
+package data
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/doug-martin/goqu/v9/exp"
+	"github.com/google/uuid"
+)
+
+// NewMemoryModels returns models keeping their data in memory, to run the handlers and
+// middlewares without PostgreSQL. They behave like the models (soft deletes, duplicate
+// emails and usernames, edit conflicts, token expiry, the audit chain...) with a few
+// differences:
+//
+//   - roles have the permissions given here, and unknown role and permission codes are
+//     granted rather than ignored. Only the roles given here are known to GetAllByCode,
+//     while every permission code is.
+//   - transactions run one at a time, and rolling one back also undoes the changes made
+//     concurrently outside of a transaction
+//   - the conditions given to GetAll and Each only support comparisons, IN, LIKE and
+//     ILIKE, IS (NOT) NULL, lower(), AND and OR
+//   - searching users matches the words anywhere in their names, username and email
+//     address, without typos, and ranks them all the same
+//   - there is no row level security
+func NewMemoryModels(rolePermissions map[string]Permissions) Models {
+	s := &memoryStore{
+		rolePermissions: map[string]Permissions{},
+		roleIDs:         map[uuid.UUID]string{},
+		memoryTables:    newMemoryTables(),
+	}
+
+	for role, permissions := range rolePermissions {
+		s.rolePermissions[role] = append(Permissions{}, permissions...)
+		s.roleIDs[uuid.New()] = role
+	}
+
+	return Models{
+		Users:         memoryUsers{s},
+		Tokens:        memoryTokens{s},
+		Permissions:   memoryPermissions{s},
+		Roles:         memoryRoles{s},
+		Organizations: memoryOrganizations{s},
+		Groups:        memoryGroups{s},
+		Audit:         memoryAudit{s},
+		Exports:       memoryExports{s},
+		memory:        s,
+	}
+}
+
+// memoryStore holds the data of the in-memory models. Every operation holds mu while it
+// runs, and transactions hold txMu until they end.
+type memoryStore struct {
+	mu   sync.RWMutex
+	txMu sync.Mutex
+
+	rolePermissions map[string]Permissions
+	roleIDs         map[uuid.UUID]string
+
+	memoryTables
+}
+
+// memoryGrant is a role or permission granted directly to a user.
+type memoryGrant struct {
+	Grant
+	Code string
+}
+
+type memoryTables struct {
+	users           map[uuid.UUID]User
+	tokens          []Token
+	userRoles       map[uuid.UUID][]memoryGrant
+	userPermissions map[uuid.UUID][]memoryGrant
+	orgs            map[uuid.UUID]Organization
+	memberships     map[uuid.UUID][]Membership
+	groups          map[uuid.UUID]Group
+	groupMembers    map[uuid.UUID][]uuid.UUID
+	audit           []AuditEvent
+	exports         []DataExport
+}
+
+func newMemoryTables() memoryTables {
+	return memoryTables{
+		users:           map[uuid.UUID]User{},
+		userRoles:       map[uuid.UUID][]memoryGrant{},
+		userPermissions: map[uuid.UUID][]memoryGrant{},
+		orgs:            map[uuid.UUID]Organization{},
+		memberships:     map[uuid.UUID][]Membership{},
+		groups:          map[uuid.UUID]Group{},
+		groupMembers:    map[uuid.UUID][]uuid.UUID{},
+	}
+}
+
+// clone copies the tables. The records are copied by value, and the slices they hold
+// are never modified in place, so they can be shared.
+func (t memoryTables) clone() memoryTables {
+	c := newMemoryTables()
+
+	for k, v := range t.users {
+		c.users[k] = v
+	}
+	c.tokens = append(c.tokens, t.tokens...)
+	for k, v := range t.userRoles {
+		c.userRoles[k] = append([]memoryGrant{}, v...)
+	}
+	for k, v := range t.userPermissions {
+		c.userPermissions[k] = append([]memoryGrant{}, v...)
+	}
+	for k, v := range t.orgs {
+		c.orgs[k] = v
+	}
+	for k, v := range t.memberships {
+		c.memberships[k] = append([]Membership{}, v...)
+	}
+	for k, v := range t.groups {
+		c.groups[k] = v
+	}
+	for k, v := range t.groupMembers {
+		c.groupMembers[k] = append([]uuid.UUID{}, v...)
+	}
+	c.audit = append(c.audit, t.audit...)
+	c.exports = append(c.exports, t.exports...)
+
+	return c
+}
+
+const memoryTxContextKey = contextKey("memory_tx")
+
+// transaction runs fn, restoring the tables as they were before if it fails.
+func (s *memoryStore) transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxContextKey) != nil {
+		return fn(ctx)
+	}
+
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.RLock()
+	snapshot := s.memoryTables.clone()
+	s.mu.RUnlock()
+
+	err := fn(context.WithValue(ctx, memoryTxContextKey, true))
+	if err != nil {
+		s.mu.Lock()
+		s.memoryTables = snapshot
+		s.mu.Unlock()
+	}
+
+	return err
+}
+
+// rowValues returns the fields of a record by column name, as they would be sent to
+// the database.
+func rowValues(record interface{}) map[string]interface{} {
+	row := map[string]interface{}{}
+	addMemoryColumns(row, reflect.Indirect(reflect.ValueOf(record)))
+	return row
+}
+
+func addMemoryColumns(row map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		column := field.Tag.Get("db")
+
+		if column == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			addMemoryColumns(row, v.Field(i))
+			continue
+		}
+
+		if column == "" || column == "-" {
+			continue
+		}
+
+		row[column] = memoryValue(v.Field(i).Interface())
+	}
+}
+
+// memoryValue converts the value to what a driver would get, so values of different
+// types can be compared.
+func memoryValue(value interface{}) interface{} {
+	if valuer, ok := value.(driver.Valuer); ok {
+		v, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		value = v
+	}
+
+	switch v := value.(type) {
+	case int:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return int64(v)
+	case float32:
+		return float64(v)
+	case []byte:
+		return string(v)
+	case exp.LiteralExpression:
+		if strings.EqualFold(v.Literal(), "NOW()") {
+			return time.Now()
+		}
+	}
+
+	return value
+}
+
+// memoryMatch reports whether the row satisfies all the conditions.
+func memoryMatch(row map[string]interface{}, wheres ...goqu.Expression) (bool, error) {
+	for _, where := range wheres {
+		ok, err := memoryEval(row, where)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func memoryEval(row map[string]interface{}, e exp.Expression) (bool, error) {
+	switch e := e.(type) {
+	case exp.Ex:
+		list, err := e.ToExpressions()
+		if err != nil {
+			return false, err
+		}
+		return memoryEval(row, list)
+	case exp.ExOr:
+		list, err := e.ToExpressions()
+		if err != nil {
+			return false, err
+		}
+		return memoryEval(row, list)
+	case exp.ExpressionList:
+		for _, item := range e.Expressions() {
+			ok, err := memoryEval(row, item)
+			if err != nil {
+				return false, err
+			}
+			if e.Type() == exp.OrType && ok {
+				return true, nil
+			}
+			if e.Type() == exp.AndType && !ok {
+				return false, nil
+			}
+		}
+		return e.Type() == exp.AndType || e.IsEmpty(), nil
+	case exp.BooleanExpression:
+		return memoryEvalBoolean(row, e)
+	}
+
+	return false, fmt.Errorf("memory models: unsupported condition %T", e)
+}
+
+func memoryEvalBoolean(row map[string]interface{}, e exp.BooleanExpression) (bool, error) {
+	lhs, err := memoryOperand(row, e.LHS())
+	if err != nil {
+		return false, err
+	}
+
+	rhs := e.RHS()
+
+	switch e.Op() {
+	case exp.IsOp, exp.IsNotOp:
+		is := rhs == nil && lhs == nil
+		if b, ok := rhs.(bool); ok {
+			is = lhs == b
+		}
+		return is == (e.Op() == exp.IsOp), nil
+	case exp.InOp, exp.NotInOp:
+		values := reflect.ValueOf(rhs)
+		if values.Kind() != reflect.Slice {
+			return false, fmt.Errorf("memory models: unsupported IN operand %T", rhs)
+		}
+		in := false
+		for i := 0; i < values.Len(); i++ {
+			if c, ok := memoryCompare(lhs, memoryValue(values.Index(i).Interface())); ok && c == 0 {
+				in = true
+				break
+			}
+		}
+		return lhs != nil && in == (e.Op() == exp.InOp), nil
+	case exp.LikeOp, exp.NotLikeOp, exp.ILikeOp, exp.NotILikeOp:
+		s, ok1 := lhs.(string)
+		pattern, ok2 := rhs.(string)
+		if !ok1 || !ok2 {
+			return false, nil
+		}
+		insensitive := e.Op() == exp.ILikeOp || e.Op() == exp.NotILikeOp
+		match := likePattern(pattern, insensitive).MatchString(s)
+		return match == (e.Op() == exp.LikeOp || e.Op() == exp.ILikeOp), nil
+	}
+
+	c, ok := memoryCompare(lhs, memoryValue(rhs))
+	if !ok {
+		// comparing with NULL
+		return false, nil
+	}
+
+	switch e.Op() {
+	case exp.EqOp:
+		return c == 0, nil
+	case exp.NeqOp:
+		return c != 0, nil
+	case exp.GtOp:
+		return c > 0, nil
+	case exp.GteOp:
+		return c >= 0, nil
+	case exp.LtOp:
+		return c < 0, nil
+	case exp.LteOp:
+		return c <= 0, nil
+	}
+
+	return false, fmt.Errorf("memory models: unsupported operator %s", e.Op())
+}
+
+// memoryOperand returns the value of a column, or of lower() of a column.
+func memoryOperand(row map[string]interface{}, e exp.Expression) (interface{}, error) {
+	switch e := e.(type) {
+	case exp.IdentifierExpression:
+		column, _ := e.GetCol().(string)
+		value, ok := row[column]
+		if !ok {
+			return nil, fmt.Errorf("memory models: unknown column %q", column)
+		}
+		return value, nil
+	case exp.SQLFunctionExpression:
+		if strings.EqualFold(e.Name(), "lower") && len(e.Args()) == 1 {
+			arg, ok := e.Args()[0].(exp.Expression)
+			if ok {
+				value, err := memoryOperand(row, arg)
+				if s, ok := value.(string); ok {
+					return strings.ToLower(s), err
+				}
+				return value, err
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("memory models: unsupported operand %T", e)
+}
+
+// memoryCompare compares two values of the same kind. It returns false if they can't be
+// compared, which is the case when either is NULL.
+func memoryCompare(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case int64:
+		switch b := b.(type) {
+		case int64:
+			return compareFloats(float64(a), float64(b)), true
+		case float64:
+			return compareFloats(float64(a), b), true
+		}
+	case float64:
+		switch b := b.(type) {
+		case int64:
+			return compareFloats(a, float64(b)), true
+		case float64:
+			return compareFloats(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			switch {
+			case a == b:
+				return 0, true
+			case b:
+				return -1, true
+			default:
+				return 1, true
+			}
+		}
+	case time.Time:
+		// times come back from cursors as strings
+		if s, ok := b.(string); ok {
+			t, err := time.Parse(time.RFC3339Nano, s)
+			if err != nil {
+				return 0, false
+			}
+			b = t
+		}
+		if b, ok := b.(time.Time); ok {
+			switch {
+			case a.Before(b):
+				return -1, true
+			case a.After(b):
+				return 1, true
+			default:
+				return 0, true
+			}
+		}
+	}
+
+	return 0, false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// likePattern converts a LIKE pattern to a regular expression.
+func likePattern(pattern string, insensitive bool) *regexp.Regexp {
+	var b strings.Builder
+
+	if insensitive {
+		b.WriteString("(?is)")
+	} else {
+		b.WriteString("(?s)")
+	}
+	b.WriteString("^")
+
+	escaped := false
+	for _, r := range pattern {
+		switch {
+		case escaped:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '%':
+			b.WriteString(".*")
+		case r == '_':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+
+	b.WriteString("$")
+
+	return regexp.MustCompile(b.String())
+}
+
+// memorySort sorts the rows by the keys.
+func memorySort(rows []map[string]interface{}, keys []sortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, key := range keys {
+			a, b := rows[i][key.column], rows[j][key.column]
+
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return key.nullsFirst
+			case b == nil:
+				return !key.nullsFirst
+			}
+
+			c, _ := memoryCompare(a, b)
+			if c != 0 {
+				return (c < 0) != key.desc
+			}
+		}
+
+		return false
+	})
+}
+
+// memoryPage returns the rows of the page, fetched as the pagination does.
+func memoryPage(rows []map[string]interface{}, p pagination) ([]map[string]interface{}, error) {
+	if where := p.where(); where != nil {
+		after := []map[string]interface{}{}
+		for _, row := range rows {
+			ok, err := memoryMatch(row, where)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				after = append(after, row)
+			}
+		}
+		rows = after
+	}
+
+	memorySort(rows, p.fetchKeys())
+
+	if !p.paged() {
+		return rows, nil
+	}
+
+	start := int(p.offset())
+	if start > len(rows) {
+		start = len(rows)
+	}
+
+	end := start + int(p.limit())
+	if end > len(rows) {
+		end = len(rows)
+	}
+
+	return rows[start:end], nil
+}
@@ -0,0 +1,390 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryRoles is the in-memory RoleRepository.
+type memoryRoles struct {
+	s *memoryStore
+}
+
+// memoryPermissions is the in-memory PermissionRepository.
+type memoryPermissions struct {
+	s *memoryStore
+}
+
+func (g memoryGrant) active() bool {
+	now := time.Now()
+	return !g.ValidFrom.After(now) && (!g.ValidUntil.Valid || g.ValidUntil.Time.After(now))
+}
+
+// activeGrants returns the codes of the active grants.
+func activeGrants(grants []memoryGrant) []string {
+	codes := []string{}
+	for _, g := range grants {
+		if g.active() {
+			codes = append(codes, g.Code)
+		}
+	}
+
+	return codes
+}
+
+// userGroups returns the groups the user is a member of.
+func (s *memoryStore) userGroups(userID uuid.UUID) []Group {
+	groups := []Group{}
+	for groupID, members := range s.groupMembers {
+		for _, id := range members {
+			if id == userID {
+				groups = append(groups, s.groups[groupID])
+				break
+			}
+		}
+	}
+
+	return groups
+}
+
+// membershipRoles returns the roles of the user in the organization.
+func (s *memoryStore) membershipRoles(userID, orgID uuid.UUID) Roles {
+	var roles Roles
+	for _, membership := range s.memberships[orgID] {
+		if membership.UserID == userID {
+			for _, role := range membership.Roles {
+				if OrganizationRoles.Include(role) {
+					roles = append(roles, role)
+				}
+			}
+		}
+	}
+
+	return roles
+}
+
+// userRoleCodes returns the roles granted to the user, either directly or through
+// their groups.
+func (s *memoryStore) userRoleCodes(userID uuid.UUID) []string {
+	codes := activeGrants(s.userRoles[userID])
+	for _, group := range s.userGroups(userID) {
+		codes = append(codes, group.Roles...)
+	}
+
+	return codes
+}
+
+// userPermissionCodes returns the permissions granted to the user, either directly,
+// through their roles, through their groups or through the roles of their groups.
+func (s *memoryStore) userPermissionCodes(userID uuid.UUID) []string {
+	codes := activeGrants(s.userPermissions[userID])
+	for _, role := range activeGrants(s.userRoles[userID]) {
+		codes = append(codes, s.rolePermissions[role]...)
+	}
+	for _, group := range s.userGroups(userID) {
+		codes = append(codes, group.Permissions...)
+		for _, role := range group.Roles {
+			codes = append(codes, s.rolePermissions[role]...)
+		}
+	}
+
+	return codes
+}
+
+// uniqueCodes returns the codes without duplicates, in their first order.
+func uniqueCodes(codes []string) []string {
+	var unique []string
+	seen := map[string]bool{}
+
+	for _, code := range codes {
+		if !seen[code] {
+			seen[code] = true
+			unique = append(unique, code)
+		}
+	}
+
+	return unique
+}
+
+// sortAccess sorts the grants by code then source, dropping duplicates.
+func sortAccess(grants []AccessGrant) []AccessGrant {
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Code != grants[j].Code {
+			return grants[i].Code < grants[j].Code
+		}
+		return grants[i].Source < grants[j].Source
+	})
+
+	unique := []AccessGrant{}
+	for i := range grants {
+		if i == 0 || grants[i] != grants[i-1] {
+			unique = append(unique, grants[i])
+		}
+	}
+
+	return unique
+}
+
+// grantCodes grants the codes to the user in the grants, replacing the existing grants
+// of the same codes.
+func grantCodes(grants map[uuid.UUID][]memoryGrant, userID uuid.UUID, grant Grant, codes []string) {
+	if grant.ValidFrom.IsZero() {
+		grant.ValidFrom = time.Now()
+	}
+
+	kept := []memoryGrant{}
+	for _, g := range grants[userID] {
+		if !Roles(codes).Include(g.Code) {
+			kept = append(kept, g)
+		}
+	}
+
+	for _, code := range uniqueCodes(codes) {
+		kept = append(kept, memoryGrant{Grant: grant, Code: code})
+	}
+
+	grants[userID] = kept
+}
+
+// revokeCodes removes the grants of the codes from the user. It returns
+// ErrRecordNotFound if there were none.
+func revokeCodes(grants map[uuid.UUID][]memoryGrant, userID uuid.UUID, codes []string) error {
+	kept := []memoryGrant{}
+	for _, g := range grants[userID] {
+		if !Roles(codes).Include(g.Code) {
+			kept = append(kept, g)
+		}
+	}
+
+	if len(kept) == len(grants[userID]) {
+		return ErrRecordNotFound
+	}
+
+	grants[userID] = kept
+	return nil
+}
+
+// deleteExpiredGrants removes the grants whose validity period has ended and writes
+// an audit event for each of them. s.mu must be held.
+func (s *memoryStore) deleteExpiredGrants(ctx context.Context, grants map[uuid.UUID][]memoryGrant, field string) ([]ExpiredGrant, error) {
+	expired := []ExpiredGrant{}
+
+	for userID, userGrants := range grants {
+		kept := []memoryGrant{}
+		for _, g := range userGrants {
+			if g.ValidUntil.Valid && !g.ValidUntil.Time.After(time.Now()) {
+				expired = append(expired, ExpiredGrant{
+					UserID:     userID,
+					Code:       g.Code,
+					ValidUntil: g.ValidUntil.Time,
+					Reason:     g.Reason,
+				})
+				continue
+			}
+			kept = append(kept, g)
+		}
+		grants[userID] = kept
+	}
+
+	for _, grant := range expired {
+		err := s.appendAudit(ctx, expiredGrantEvent(field, grant))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return expired, nil
+}
+
+func (m memoryRoles) GetAllForUser(ctx context.Context, userID uuid.UUID) (Roles, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	return uniqueCodes(m.s.userRoleCodes(userID)), nil
+}
+
+func (m memoryRoles) GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Roles, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	codes := append(m.s.userRoleCodes(userID), m.s.membershipRoles(userID, orgID)...)
+	return uniqueCodes(codes), nil
+}
+
+func (m memoryRoles) GetAllByCode(ctx context.Context, codes ...string) (Roles, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	var roles Roles
+	for _, code := range uniqueCodes(codes) {
+		if _, ok := m.s.rolePermissions[code]; ok {
+			roles = append(roles, code)
+		}
+	}
+
+	return roles, nil
+}
+
+func (m memoryRoles) GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	grants := []AccessGrant{}
+	for _, code := range activeGrants(m.s.userRoles[userID]) {
+		grants = append(grants, AccessGrant{Code: code, Source: "direct"})
+	}
+	for _, group := range m.s.userGroups(userID) {
+		for _, code := range group.Roles {
+			grants = append(grants, AccessGrant{Code: code, Source: "group:" + group.Name})
+		}
+	}
+
+	return sortAccess(grants), nil
+}
+
+func (m memoryRoles) AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	return m.GrantForUser(ctx, userID, Grant{}, codes...)
+}
+
+func (m memoryRoles) GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	grantCodes(m.s.userRoles, userID, grant, codes)
+	return nil
+}
+
+func (m memoryRoles) RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return revokeCodes(m.s.userRoles, userID, codes)
+}
+
+func (m memoryRoles) DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return m.s.deleteExpiredGrants(ctx, m.s.userRoles, "role")
+}
+
+func (m memoryPermissions) GetAllForUser(ctx context.Context, userID uuid.UUID) (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	return uniqueCodes(m.s.userPermissionCodes(userID)), nil
+}
+
+func (m memoryPermissions) GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	codes := m.s.userPermissionCodes(userID)
+	for _, role := range m.s.membershipRoles(userID, orgID) {
+		for _, code := range m.s.rolePermissions[role] {
+			if strings.HasPrefix(code, OrganizationPermissionPrefix) {
+				codes = append(codes, code)
+			}
+		}
+	}
+
+	return uniqueCodes(codes), nil
+}
+
+// GetAllByCode returns the codes as they are, there being no list of the permissions
+// to check them against.
+func (m memoryPermissions) GetAllByCode(ctx context.Context, codes ...string) (Permissions, error) {
+	return uniqueCodes(codes), nil
+}
+
+func (m memoryPermissions) GetAllForRoles(ctx context.Context, roles ...string) (Permissions, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	var codes []string
+	for _, role := range roles {
+		codes = append(codes, m.s.rolePermissions[role]...)
+	}
+
+	return uniqueCodes(codes), nil
+}
+
+func (m memoryPermissions) GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	grants := []AccessGrant{}
+	for _, code := range activeGrants(m.s.userPermissions[userID]) {
+		grants = append(grants, AccessGrant{Code: code, Source: "direct"})
+	}
+	for _, role := range activeGrants(m.s.userRoles[userID]) {
+		for _, code := range m.s.rolePermissions[role] {
+			grants = append(grants, AccessGrant{Code: code, Source: "role:" + role})
+		}
+	}
+	for _, group := range m.s.userGroups(userID) {
+		for _, code := range group.Permissions {
+			grants = append(grants, AccessGrant{Code: code, Source: "group:" + group.Name})
+		}
+		for _, role := range group.Roles {
+			for _, code := range m.s.rolePermissions[role] {
+				grants = append(grants, AccessGrant{Code: code, Source: "group:" + group.Name + "/role:" + role})
+			}
+		}
+	}
+
+	return sortAccess(grants), nil
+}
+
+func (m memoryPermissions) AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	return m.GrantForUser(ctx, userID, Grant{}, codes...)
+}
+
+func (m memoryPermissions) GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	grantCodes(m.s.userPermissions, userID, grant, codes)
+	return nil
+}
+
+func (m memoryPermissions) RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return revokeCodes(m.s.userPermissions, userID, codes)
+}
+
+func (m memoryPermissions) DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return m.s.deleteExpiredGrants(ctx, m.s.userPermissions, "permission")
+}
+
+func (m memoryPermissions) AddForRole(ctx context.Context, roleID uuid.UUID, codes ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	role, ok := m.s.roleIDs[roleID]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	permissions := append(Permissions{}, m.s.rolePermissions[role]...)
+	m.s.rolePermissions[role] = uniqueCodes(append(permissions, codes...))
+
+	return nil
+}
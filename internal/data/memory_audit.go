@@ -0,0 +1,141 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+)
+
+// memoryAudit is the in-memory AuditRepository.
+type memoryAudit struct {
+	s *memoryStore
+}
+
+// appendAudit chains the event to the last one and stores it. s.mu must be held.
+func (s *memoryStore) appendAudit(ctx context.Context, event *AuditEvent) error {
+	fillAuditSource(ctx, event)
+
+	event.AuditEventID = uuid.New()
+	event.Sequence = int64(len(s.audit)) + 1
+	event.PrevHash = ""
+	if len(s.audit) > 0 {
+		event.PrevHash = s.audit[len(s.audit)-1].Hash
+	}
+	event.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+
+	var err error
+	event.Hash, err = event.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	s.audit = append(s.audit, *event)
+	return nil
+}
+
+func (m memoryAudit) Record(ctx context.Context, action, targetType, targetID string, before, after interface{}) error {
+	changes, err := AuditDiff(before, after)
+	if err != nil {
+		return err
+	}
+
+	return m.Insert(ctx, &AuditEvent{
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Changes:    changes,
+	})
+}
+
+func (m memoryAudit) Insert(ctx context.Context, event *AuditEvent) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	return m.s.appendAudit(ctx, event)
+}
+
+// matching returns copies of the events matching the conditions, in chain order, along
+// with their rows.
+func (m memoryAudit) matching(wheres []goqu.Expression) ([]AuditEvent, []map[string]interface{}, error) {
+	m.s.mu.RLock()
+	all := append([]AuditEvent{}, m.s.audit...)
+	m.s.mu.RUnlock()
+
+	events := []AuditEvent{}
+	rows := []map[string]interface{}{}
+
+	for _, event := range all {
+		row := rowValues(&event)
+
+		ok, err := memoryMatch(row, wheres...)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if ok {
+			events = append(events, event)
+			rows = append(rows, row)
+		}
+	}
+
+	return events, rows, nil
+}
+
+func (m memoryAudit) GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*AuditEvent, Metadata, error) {
+	p, err := filters.pagination("sequence")
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	events, rows, err := m.matching(wheres)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	bySequence := map[interface{}]AuditEvent{}
+	for i := range events {
+		bySequence[rows[i]["sequence"]] = events[i]
+	}
+
+	totalRecords := len(rows)
+
+	rows, err = memoryPage(rows, p)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	result := []*AuditEvent{}
+	for _, row := range rows {
+		e := bySequence[row["sequence"]]
+		result = append(result, &e)
+	}
+
+	n, metadata, err := p.finish(result, totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return result[:n], metadata, nil
+}
+
+func (m memoryAudit) VerifyChain(ctx context.Context) ([]AuditChainBreak, int, error) {
+	return verifyAuditChain(ctx, m.Each)
+}
+
+func (m memoryAudit) Each(ctx context.Context, wheres []goqu.Expression, fn func(event *AuditEvent) error) error {
+	events, _, err := m.matching(wheres)
+	if err != nil {
+		return err
+	}
+
+	for i := range events {
+		err := fn(&events[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
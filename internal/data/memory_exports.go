@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryExports is the in-memory ExportRepository.
+type memoryExports struct {
+	s *memoryStore
+}
+
+func (m memoryExports) Insert(ctx context.Context, export *DataExport) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[export.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	export.ExportID = uuid.New()
+	export.Status = ExportPending
+	export.CreatedAt = time.Now()
+
+	m.s.exports = append(m.s.exports, *export)
+	return nil
+}
+
+// update applies fn to the stored export, and reports whether it exists. Like an UPDATE
+// matching no row, it does nothing if it doesn't.
+func (m memoryExports) update(export *DataExport, fn func(e *DataExport)) bool {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	found := false
+	exports := append([]DataExport{}, m.s.exports...)
+	for i := range exports {
+		if exports[i].ExportID == export.ExportID {
+			fn(&exports[i])
+			found = true
+		}
+	}
+	m.s.exports = exports
+
+	return found
+}
+
+func (m memoryExports) Complete(ctx context.Context, export *DataExport) error {
+	found := m.update(export, func(e *DataExport) {
+		e.Status = ExportReady
+		e.Content = export.Content
+		e.ExpiresAt = export.ExpiresAt
+	})
+	if !found {
+		return ErrRecordNotFound
+	}
+
+	export.Status = ExportReady
+	return nil
+}
+
+func (m memoryExports) Fail(ctx context.Context, export *DataExport) error {
+	found := m.update(export, func(e *DataExport) {
+		e.Status = ExportFailed
+	})
+	if !found {
+		return ErrRecordNotFound
+	}
+
+	export.Status = ExportFailed
+	return nil
+}
+
+func (m memoryExports) GetLatestForUser(ctx context.Context, userID uuid.UUID) (*DataExport, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	var latest *DataExport
+	for _, e := range m.s.exports {
+		if e.UserID != userID || e.Status != ExportReady || !e.ExpiresAt.Valid || !e.ExpiresAt.Time.After(time.Now()) {
+			continue
+		}
+
+		if latest == nil || e.CreatedAt.After(latest.CreatedAt) {
+			e := e
+			latest = &e
+		}
+	}
+
+	if latest == nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return latest, nil
+}
+
+func (m memoryExports) DeleteAllForUser(ctx context.Context, userID uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	exports := []DataExport{}
+	for _, e := range m.s.exports {
+		if e.UserID != userID {
+			exports = append(exports, e)
+		}
+	}
+	m.s.exports = exports
+
+	return nil
+}
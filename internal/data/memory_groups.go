@@ -0,0 +1,179 @@
+package data
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// memoryGroups is the in-memory GroupRepository.
+type memoryGroups struct {
+	s *memoryStore
+}
+
+// checkGroupName returns ErrDuplicateGroupName if another group has the name of the
+// group.
+func (s *memoryStore) checkGroupName(group Group) error {
+	for id, other := range s.groups {
+		if id != group.GroupID && other.Name == group.Name {
+			return ErrDuplicateGroupName
+		}
+	}
+
+	return nil
+}
+
+func (m memoryGroups) Insert(ctx context.Context, group *Group) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	g := *group
+	g.GroupID = uuid.New()
+	g.CreatedAt = nullTimeNow()
+	g.UpdatedAt = g.CreatedAt
+	g.Version = 1
+	g.Roles = uniqueCodes(g.Roles)
+	g.Permissions = uniqueCodes(g.Permissions)
+
+	err := m.s.checkGroupName(g)
+	if err != nil {
+		return err
+	}
+
+	m.s.groups[g.GroupID] = g
+
+	group.GroupID, group.CreatedAt, group.UpdatedAt, group.Version = g.GroupID, g.CreatedAt, g.UpdatedAt, g.Version
+	return nil
+}
+
+func (m memoryGroups) Get(ctx context.Context, id uuid.UUID) (*Group, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	group, ok := m.s.groups[id]
+	if !ok {
+		return nil, ErrRecordNotFound
+	}
+
+	group.Roles = append(Roles{}, group.Roles...)
+	group.Permissions = append(Permissions{}, group.Permissions...)
+
+	return &group, nil
+}
+
+func (m memoryGroups) GetAll(ctx context.Context) ([]*Group, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	groups := []*Group{}
+	for _, group := range m.s.groups {
+		group := group
+		group.Roles = nil
+		group.Permissions = nil
+		groups = append(groups, &group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups, nil
+}
+
+func (m memoryGroups) Update(ctx context.Context, group *Group) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.groups[group.GroupID]
+	if !ok || stored.Version != group.Version {
+		return ErrEditConflict
+	}
+
+	stored.Name = group.Name
+
+	err := m.s.checkGroupName(stored)
+	if err != nil {
+		return err
+	}
+
+	stored.Version++
+	stored.UpdatedAt = nullTimeNow()
+	m.s.groups[group.GroupID] = stored
+
+	group.Version = stored.Version
+	return nil
+}
+
+func (m memoryGroups) Delete(ctx context.Context, id uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.groups[id]; !ok {
+		return ErrRecordNotFound
+	}
+
+	delete(m.s.groups, id)
+	delete(m.s.groupMembers, id)
+
+	return nil
+}
+
+func (m memoryGroups) SetAccess(ctx context.Context, groupID uuid.UUID, roles Roles, permissions Permissions) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	group, ok := m.s.groups[groupID]
+	if !ok {
+		return nil
+	}
+
+	group.Roles = uniqueCodes(roles)
+	group.Permissions = uniqueCodes(permissions)
+	m.s.groups[groupID] = group
+
+	return nil
+}
+
+func (m memoryGroups) GetMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	return append([]uuid.UUID{}, m.s.groupMembers[groupID]...), nil
+}
+
+func (m memoryGroups) AddMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.groups[groupID]; !ok && len(userIDs) > 0 {
+		return ErrRecordNotFound
+	}
+
+	for _, id := range userIDs {
+		if _, ok := m.s.users[id]; !ok {
+			return ErrRecordNotFound
+		}
+	}
+
+	members := append([]uuid.UUID{}, m.s.groupMembers[groupID]...)
+	for _, id := range userIDs {
+		members = append(removeUUIDs(members, id), id)
+	}
+	m.s.groupMembers[groupID] = members
+
+	return nil
+}
+
+func (m memoryGroups) RemoveMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	kept := removeUUIDs(m.s.groupMembers[groupID], userIDs...)
+	if len(kept) == len(m.s.groupMembers[groupID]) {
+		return ErrRecordNotFound
+	}
+
+	m.s.groupMembers[groupID] = kept
+	return nil
+}
@@ -0,0 +1,173 @@
+package data
+
+import (
+	"context"
+	"sort"
+
+	"github.com/google/uuid"
+)
+
+// memoryOrganizations is the in-memory OrganizationRepository.
+type memoryOrganizations struct {
+	s *memoryStore
+}
+
+func (m memoryOrganizations) Insert(ctx context.Context, org *Organization) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	org.OrganizationID = uuid.New()
+	org.CreatedAt = nullTimeNow()
+	org.UpdatedAt = org.CreatedAt
+	org.Version = 1
+
+	m.s.orgs[org.OrganizationID] = *org
+	return nil
+}
+
+func (m memoryOrganizations) Get(ctx context.Context, id uuid.UUID) (*Organization, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	org, ok := m.s.orgs[id]
+	if !ok || org.RemovedAt.Valid {
+		return nil, ErrRecordNotFound
+	}
+
+	return &org, nil
+}
+
+func (m memoryOrganizations) GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Organization, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	orgs := []*Organization{}
+	for orgID, members := range m.s.memberships {
+		org, ok := m.s.orgs[orgID]
+		if !ok || org.RemovedAt.Valid {
+			continue
+		}
+
+		for _, membership := range members {
+			if membership.UserID == userID {
+				orgs = append(orgs, &org)
+				break
+			}
+		}
+	}
+
+	sort.Slice(orgs, func(i, j int) bool {
+		return orgs[i].Name < orgs[j].Name
+	})
+
+	return orgs, nil
+}
+
+func (m memoryOrganizations) Update(ctx context.Context, org *Organization) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	stored, ok := m.s.orgs[org.OrganizationID]
+	if !ok || stored.Version != org.Version || stored.RemovedAt.Valid {
+		return ErrEditConflict
+	}
+
+	stored.Name = org.Name
+	stored.Version++
+	stored.UpdatedAt = nullTimeNow()
+	m.s.orgs[org.OrganizationID] = stored
+
+	org.Version = stored.Version
+	return nil
+}
+
+func (m memoryOrganizations) GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*Membership, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	for _, membership := range m.s.memberships[orgID] {
+		if membership.UserID == userID {
+			membership.Roles = append(Roles{}, membership.Roles...)
+			return &membership, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+func (m memoryOrganizations) GetMembers(ctx context.Context, orgID uuid.UUID) ([]*Membership, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	members := []*Membership{}
+	for _, membership := range m.s.memberships[orgID] {
+		membership := membership
+		membership.Roles = append(Roles{}, membership.Roles...)
+		sort.Strings(membership.Roles)
+		members = append(members, &membership)
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].CreatedAt.Time.Before(members[j].CreatedAt.Time)
+	})
+
+	return members, nil
+}
+
+func (m memoryOrganizations) AddMember(ctx context.Context, orgID, userID uuid.UUID, roles ...string) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[userID]; !ok {
+		return ErrRecordNotFound
+	}
+	if _, ok := m.s.orgs[orgID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	// like the models, only the organization roles are given
+	var orgRoles Roles
+	for _, role := range roles {
+		if OrganizationRoles.Include(role) {
+			orgRoles = append(orgRoles, role)
+		}
+	}
+
+	members := append([]Membership{}, m.s.memberships[orgID]...)
+
+	for i := range members {
+		if members[i].UserID == userID {
+			members[i].Roles = uniqueCodes(append(append(Roles{}, members[i].Roles...), orgRoles...))
+			m.s.memberships[orgID] = members
+			return nil
+		}
+	}
+
+	m.s.memberships[orgID] = append(members, Membership{
+		OrganizationID: orgID,
+		UserID:         userID,
+		Roles:          uniqueCodes(append(Roles{}, orgRoles...)),
+		CreatedAt:      nullTimeNow(),
+	})
+
+	return nil
+}
+
+func (m memoryOrganizations) RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	kept := []Membership{}
+	for _, membership := range m.s.memberships[orgID] {
+		if membership.UserID != userID {
+			kept = append(kept, membership)
+		}
+	}
+
+	if len(kept) == len(m.s.memberships[orgID]) {
+		return ErrRecordNotFound
+	}
+
+	m.s.memberships[orgID] = kept
+	return nil
+}
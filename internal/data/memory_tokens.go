@@ -0,0 +1,104 @@
+package data
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// memoryTokens is the in-memory TokenRepository.
+type memoryTokens struct {
+	s *memoryStore
+}
+
+func (m memoryTokens) New(ctx context.Context, userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
+	token, err := generateToken(userID, ttl, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.Insert(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	err = m.s.appendAudit(ctx, &AuditEvent{
+		Action:     AuditTokenCreate,
+		TargetType: AuditTargetUser,
+		TargetID:   userID.String(),
+		Changes: AuditChanges{
+			"scope":  {After: scope},
+			"expiry": {After: token.Expiry},
+		},
+	})
+	return token, err
+}
+
+func (m memoryTokens) Insert(ctx context.Context, token *Token) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	if _, ok := m.s.users[token.UserID]; !ok {
+		return ErrRecordNotFound
+	}
+
+	t := *token
+	t.Plaintext = ""
+	m.s.tokens = append(m.s.tokens, t)
+
+	return nil
+}
+
+func (m memoryTokens) DeleteAllForUser(ctx context.Context, scope string, userID uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.tokens = filterTokens(m.s.tokens, func(t Token) bool {
+		return t.UserID != userID || t.Scope != scope
+	})
+
+	return nil
+}
+
+func (m memoryTokens) GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Token, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	tokens := []*Token{}
+	for _, t := range m.s.tokens {
+		if t.UserID == userID && t.Expiry.After(time.Now()) {
+			tokens = append(tokens, &Token{UserID: t.UserID, Scope: t.Scope, Expiry: t.Expiry})
+		}
+	}
+
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].Expiry.Before(tokens[j].Expiry)
+	})
+
+	return tokens, nil
+}
+
+func (m memoryTokens) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	m.s.tokens = filterTokens(m.s.tokens, func(t Token) bool { return t.UserID != userID })
+
+	return nil
+}
+
+func filterTokens(tokens []Token, keep func(t Token) bool) []Token {
+	kept := []Token{}
+	for _, t := range tokens {
+		if keep(t) {
+			kept = append(kept, t)
+		}
+	}
+
+	return kept
+}
@@ -0,0 +1,430 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"gopkg.in/guregu/null.v4"
+)
+
+// memoryUsers is the in-memory UserRepository.
+type memoryUsers struct {
+	s *memoryStore
+}
+
+// checkUnique returns ErrDuplicateEmail or ErrDuplicateUsername if another user, which
+// isn't soft-deleted, has the email address or username of the user.
+func (s *memoryStore) checkUnique(user User) error {
+	for id, other := range s.users {
+		if id == user.UserID || other.RemovedAt.Valid {
+			continue
+		}
+
+		if strings.EqualFold(other.Email, user.Email) {
+			return ErrDuplicateEmail
+		}
+		if other.Username.Valid && user.Username.Valid && strings.EqualFold(other.Username.String, user.Username.String) {
+			return ErrDuplicateUsername
+		}
+	}
+
+	return nil
+}
+
+func (m memoryUsers) Insert(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u := *user
+	u.UserID = uuid.New()
+	u.CreatedAt = nullTimeNow()
+	u.UpdatedAt = u.CreatedAt
+	u.Version = 1
+
+	err := m.s.checkUnique(u)
+	if err != nil {
+		return err
+	}
+
+	m.s.users[u.UserID] = u
+
+	user.UserID, user.CreatedAt, user.UpdatedAt, user.Version = u.UserID, u.CreatedAt, u.UpdatedAt, u.Version
+	return nil
+}
+
+func (m memoryUsers) Get(ctx context.Context, id uuid.UUID) (*User, error) {
+	return m.find(func(u User) bool { return u.UserID == id })
+}
+
+func (m memoryUsers) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return m.find(func(u User) bool { return strings.EqualFold(u.Email, email) })
+}
+
+func (m memoryUsers) GetByUsername(ctx context.Context, username string) (*User, error) {
+	return m.find(func(u User) bool { return strings.EqualFold(u.Username.String, username) })
+}
+
+func (m memoryUsers) GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error) {
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+
+	m.s.mu.RLock()
+	var userID uuid.UUID
+	for _, token := range m.s.tokens {
+		if bytes.Equal(token.Hash, tokenHash[:]) && token.Scope == tokenScope && token.Expiry.After(time.Now()) {
+			userID = token.UserID
+			break
+		}
+	}
+	m.s.mu.RUnlock()
+
+	if userID == uuid.Nil {
+		return nil, ErrRecordNotFound
+	}
+
+	return m.Get(ctx, userID)
+}
+
+// find returns a copy of the first user matching, among those not soft-deleted.
+func (m memoryUsers) find(match func(u User) bool) (*User, error) {
+	m.s.mu.RLock()
+	defer m.s.mu.RUnlock()
+
+	for _, u := range m.s.users {
+		if !u.RemovedAt.Valid && match(u) {
+			return &u, nil
+		}
+	}
+
+	return nil, ErrRecordNotFound
+}
+
+// update applies fn to the stored user if its version is the one of user and it isn't
+// soft-deleted, then bumps the version. It returns ErrEditConflict otherwise.
+func (m memoryUsers) update(user *User, fn func(u *User) error) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[user.UserID]
+	if !ok || u.Version != user.Version || u.RemovedAt.Valid {
+		return ErrEditConflict
+	}
+
+	err := fn(&u)
+	if err != nil {
+		return err
+	}
+
+	u.Version++
+	u.UpdatedAt = nullTimeNow()
+	m.s.users[u.UserID] = u
+
+	user.Version = u.Version
+	return nil
+}
+
+func (m memoryUsers) Update(ctx context.Context, user *User) error {
+	return m.update(user, func(u *User) error {
+		u.IsActive = user.IsActive
+		u.IsStaff = user.IsStaff
+		u.IsSuperuser = user.IsSuperuser
+		if user.Password.hash != nil {
+			u.Password = user.Password
+		}
+		if user.Email != "" {
+			u.Email = user.Email
+		}
+		if user.FirstName != "" {
+			u.FirstName = user.FirstName
+		}
+		if user.LastName.Valid {
+			u.LastName = user.LastName
+		}
+		if user.Username.Valid {
+			u.Username = user.Username
+		}
+
+		return m.s.checkUnique(*u)
+	})
+}
+
+func (m memoryUsers) Delete(ctx context.Context, id uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[id]
+	if !ok {
+		return ErrRecordNotFound
+	}
+
+	u.RemovedAt = nullTimeNow()
+	m.s.users[id] = u
+
+	return nil
+}
+
+func (m memoryUsers) GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
+	return m.getAll(false, wheres, filters)
+}
+
+func (m memoryUsers) GetAllDeleted(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
+	return m.getAll(true, wheres, filters)
+}
+
+func (m memoryUsers) getAll(deleted bool, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
+	p, err := filters.pagination("user_id")
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	m.s.mu.RLock()
+	byID := map[interface{}]User{}
+	rows := []map[string]interface{}{}
+	for _, u := range m.s.users {
+		if u.RemovedAt.Valid != deleted {
+			continue
+		}
+
+		if filters.Search != "" {
+			if !memorySearch(u, filters.Search) {
+				continue
+			}
+			u.Rank = 1
+		}
+
+		row := rowValues(&u)
+
+		ok, err := memoryMatch(row, wheres...)
+		if err != nil {
+			m.s.mu.RUnlock()
+			return nil, Metadata{}, err
+		}
+
+		if ok {
+			rows = append(rows, row)
+			byID[row["user_id"]] = u
+		}
+	}
+	m.s.mu.RUnlock()
+
+	totalRecords := len(rows)
+
+	rows, err = memoryPage(rows, p)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	users := []*User{}
+	for _, row := range rows {
+		u := byID[row["user_id"]]
+		users = append(users, &u)
+	}
+
+	n, metadata, err := p.finish(users, totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users[:n], metadata, nil
+}
+
+func (m memoryUsers) SetSuspension(ctx context.Context, user *User) error {
+	return m.update(user, func(u *User) error {
+		u.Suspension = user.Suspension
+		return nil
+	})
+}
+
+func (m memoryUsers) UnsuspendExpired(ctx context.Context) ([]uuid.UUID, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	userIDs := []uuid.UUID{}
+
+	for id, u := range m.s.users {
+		if !u.SuspendedAt.Valid || !u.SuspendedUntil.Valid || u.SuspendedUntil.Time.After(time.Now()) {
+			continue
+		}
+
+		u.Suspension = Suspension{}
+		u.Version++
+		u.UpdatedAt = nullTimeNow()
+		m.s.users[id] = u
+
+		userIDs = append(userIDs, id)
+
+		err := m.s.appendAudit(ctx, &AuditEvent{
+			Action:     AuditUserUnsuspend,
+			TargetType: AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    AuditChanges{"suspension": {Before: "expired"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userIDs, nil
+}
+
+func (m memoryUsers) Restore(ctx context.Context, id uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[id]
+	if !ok || !u.RemovedAt.Valid {
+		return ErrRecordNotFound
+	}
+
+	u.RemovedAt = NullTime{}
+	u.Version++
+	u.UpdatedAt = nullTimeNow()
+
+	err := m.s.checkUnique(u)
+	if err != nil {
+		return err
+	}
+
+	m.s.users[id] = u
+	return nil
+}
+
+func (m memoryUsers) Purge(ctx context.Context, id uuid.UUID) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[id]
+	if !ok || !u.RemovedAt.Valid {
+		return ErrRecordNotFound
+	}
+
+	m.s.purgeUser(id)
+	return nil
+}
+
+func (m memoryUsers) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	userIDs := []uuid.UUID{}
+
+	for id, u := range m.s.users {
+		if !u.RemovedAt.Valid || !u.RemovedAt.Time.Before(cutoff) {
+			continue
+		}
+
+		m.s.purgeUser(id)
+		userIDs = append(userIDs, id)
+
+		err := m.s.appendAudit(ctx, &AuditEvent{
+			Action:     AuditUserPurge,
+			TargetType: AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    AuditChanges{"retention": {Before: "expired"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userIDs, nil
+}
+
+// purgeUser removes the user and, like the foreign keys cascading, what refers to them.
+func (s *memoryStore) purgeUser(id uuid.UUID) {
+	delete(s.users, id)
+	delete(s.userRoles, id)
+	delete(s.userPermissions, id)
+
+	s.tokens = filterTokens(s.tokens, func(t Token) bool { return t.UserID != id })
+
+	exports := []DataExport{}
+	for _, e := range s.exports {
+		if e.UserID != id {
+			exports = append(exports, e)
+		}
+	}
+	s.exports = exports
+
+	for orgID, members := range s.memberships {
+		kept := []Membership{}
+		for _, membership := range members {
+			if membership.UserID != id {
+				kept = append(kept, membership)
+			}
+		}
+		s.memberships[orgID] = kept
+	}
+
+	for groupID, members := range s.groupMembers {
+		s.groupMembers[groupID] = removeUUIDs(members, id)
+	}
+}
+
+func (m memoryUsers) Erase(ctx context.Context, user *User) error {
+	m.s.mu.Lock()
+	defer m.s.mu.Unlock()
+
+	u, ok := m.s.users[user.UserID]
+	if !ok || u.Version != user.Version || u.ErasedAt.Valid {
+		return ErrEditConflict
+	}
+
+	placeholder := "erased-" + u.UserID.String()
+
+	u.FirstName = "Erased"
+	u.LastName = null.String{}
+	u.Username = null.StringFrom(placeholder)
+	u.Email = placeholder + "@erased.invalid"
+	u.Password = password{hash: []byte("!")}
+	u.IsActive = false
+	u.LastLogin = null.Time{}
+	u.SuspensionReason = ""
+	u.ErasedAt = null.TimeFrom(time.Now())
+	u.Version++
+	u.UpdatedAt = nullTimeNow()
+	m.s.users[u.UserID] = u
+
+	user.Version = u.Version
+	return nil
+}
+
+// memorySearch reports whether all the words of the search appear in the names,
+// username or email address of the user.
+func memorySearch(u User, search string) bool {
+	text := strings.ToLower(strings.Join([]string{u.FirstName, u.LastName.String, u.Username.String, u.Email}, " "))
+
+	for _, word := range searchWords(search) {
+		if !strings.Contains(text, word) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func nullTimeNow() NullTime {
+	var t NullTime
+	t.Time, t.Valid = time.Now(), true
+	return t
+}
+
+func removeUUIDs(ids []uuid.UUID, remove ...uuid.UUID) []uuid.UUID {
+	kept := []uuid.UUID{}
+
+outer:
+	for _, id := range ids {
+		for _, r := range remove {
+			if id == r {
+				continue outer
+			}
+		}
+		kept = append(kept, id)
+	}
+
+	return kept
+}
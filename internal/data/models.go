@@ -20,18 +20,35 @@ type SoftDeletableTimeStampModel struct {
 	RemovedAt NullTime `json:"-" db:"deleted_at"`
 }
 
+// Models gives access to the repositories. DB is nil for the in-memory models.
 type Models struct {
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
-	Roles       RoleModel
+	DB            *sqlx.DB
+	Users         UserRepository
+	Tokens        TokenRepository
+	Permissions   PermissionRepository
+	Roles         RoleRepository
+	Organizations OrganizationRepository
+	Groups        GroupRepository
+	Audit         AuditRepository
+	Exports       ExportRepository
+
+	// the read replicas set by WithReplicas, nil without replicas
+	Replicas *Replicas
+
+	// the store of the in-memory models
+	memory *memoryStore
 }
 
 func NewModels(db *sqlx.DB) Models {
 	return Models{
-		Users:       NewUserModel(db),
-		Tokens:      NewTokenModel(db),
-		Permissions: NewPermissionModel(db),
-		Roles:       NewRoleModel(db),
+		DB:            db,
+		Users:         NewUserModel(db),
+		Tokens:        NewTokenModel(db),
+		Permissions:   NewPermissionModel(db),
+		Roles:         NewRoleModel(db),
+		Organizations: NewOrganizationModel(db),
+		Groups:        NewGroupModel(db),
+		Audit:         NewAuditModel(db),
+		Exports:       NewExportModel(db),
 	}
 }
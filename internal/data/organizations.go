@@ -0,0 +1,362 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/validator"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type Organization struct {
+	TimeStampsModel
+	SoftDeletableTimeStampModel
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	Name           string    `json:"name" db:"name"`
+	Version        int       `json:"-" db:"version"`
+}
+
+// Membership is a user belonging to an organization, with the roles they have within
+// that organization.
+type Membership struct {
+	OrganizationID uuid.UUID `json:"organization_id" db:"organization_id"`
+	UserID         uuid.UUID `json:"user_id" db:"user_id"`
+	Roles          Roles     `json:"roles" db:"-"`
+	CreatedAt      NullTime  `json:"created_at" db:"created_at"`
+}
+
+func ValidateOrganization(v *validator.Validator, org *Organization) {
+	v.Check(org.Name != "", "name", "must be provided")
+	v.Check(len(org.Name) <= 150, "name", "must not be more than 150 bytes long")
+}
+
+// OrganizationRoles are the roles the members of an organization can have within it.
+// They only grant the organization permissions (see OrganizationPermissionPrefix) there,
+// whatever else they have been given, so being a member never grants access to the
+// global routes like those of the users or the audit log.
+var OrganizationRoles = Roles{"owner", "member"}
+
+// OrganizationPermissionPrefix is the prefix of the codes of the permissions which the
+// organization roles grant.
+const OrganizationPermissionPrefix = "orgs:"
+
+// ValidateMemberRoles checks that the roles are all OrganizationRoles, naming those
+// which aren't.
+func ValidateMemberRoles(v *validator.Validator, roles Roles) {
+	var unknown []string
+	for _, role := range roles {
+		if !OrganizationRoles.Include(role) {
+			unknown = append(unknown, role)
+		}
+	}
+
+	v.Check(len(unknown) == 0, "roles", "unknown organization roles: "+strings.Join(unknown, ", "))
+	v.Check(validator.Unique(roles), "roles", "must not contain duplicate values")
+}
+
+type OrganizationModel struct {
+	DB        Conn
+	tableName string
+}
+
+func NewOrganizationModel(db *sqlx.DB) OrganizationModel {
+	return OrganizationModel{
+		DB:        Conn{pool: db},
+		tableName: "organizations",
+	}
+}
+
+func (m OrganizationModel) Insert(ctx context.Context, org *Organization) error {
+	query, args, err := goqu.
+		Insert(m.tableName).
+		Rows(map[string]interface{}{
+			"created_at": time.Now(),
+			"updated_at": time.Now(),
+			"name":       org.Name,
+		}).
+		Returning("organization_id", "created_at", "updated_at", "version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	return conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&org.OrganizationID, &org.CreatedAt, &org.UpdatedAt, &org.Version)
+}
+
+func (m OrganizationModel) Get(ctx context.Context, id uuid.UUID) (*Organization, error) {
+	query, args, err := goqu.
+		Select("*").
+		From(m.tableName).
+		Where(goqu.Ex{"organization_id": id, "deleted_at": nil}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var org Organization
+	err = conn(ctx, m.DB).GetContext(ctx, &org, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &org, nil
+}
+
+// GetAllForUser returns the organizations the user is a member of.
+func (m OrganizationModel) GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Organization, error) {
+	query, args, err := goqu.
+		Select(goqu.I("o.*")).
+		From(goqu.T(m.tableName).As("o")).
+		Join(
+			goqu.T("organizations_users").As("ou"),
+			goqu.On(goqu.I("ou.organization_id").Eq(goqu.I("o.organization_id"))),
+		).
+		Where(goqu.Ex{"ou.user_id": userID, "o.deleted_at": nil}).
+		Order(goqu.I("o.name").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	orgs := []*Organization{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &orgs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return orgs, nil
+}
+
+func (m OrganizationModel) Update(ctx context.Context, org *Organization) error {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"name":       org.Name,
+			"version":    org.Version + 1,
+			"updated_at": time.Now(),
+		}).
+		Where(goqu.Ex{
+			"organization_id": org.OrganizationID,
+			"version":         org.Version,
+			"deleted_at":      nil,
+		}).
+		Returning("version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&org.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetMembership returns the membership of the user in the organization, or
+// ErrRecordNotFound if they aren't a member.
+func (m OrganizationModel) GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*Membership, error) {
+	query, args, err := goqu.
+		Select("organization_id", "user_id", "created_at").
+		From("organizations_users").
+		Where(goqu.Ex{"organization_id": orgID, "user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var membership Membership
+	err = conn(ctx, m.DB).GetContext(ctx, &membership, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	roles, err := m.getMemberRoles(ctx, orgID, userID)
+	if err != nil {
+		return nil, err
+	}
+	membership.Roles = roles
+
+	return &membership, nil
+}
+
+// GetMembers returns all memberships of the organization, with their roles.
+func (m OrganizationModel) GetMembers(ctx context.Context, orgID uuid.UUID) ([]*Membership, error) {
+	query, args, err := goqu.
+		Select(
+			goqu.I("ou.organization_id"),
+			goqu.I("ou.user_id"),
+			goqu.I("ou.created_at"),
+			goqu.L("array_remove(array_agg(r.code ORDER BY r.code), NULL)"),
+		).
+		From(goqu.T("organizations_users").As("ou")).
+		LeftJoin(
+			goqu.T("organizations_users_roles").As("our"),
+			goqu.On(
+				goqu.I("our.organization_id").Eq(goqu.I("ou.organization_id")),
+				goqu.I("our.user_id").Eq(goqu.I("ou.user_id")),
+			),
+		).
+		LeftJoin(
+			goqu.T("roles").As("r"),
+			goqu.On(goqu.I("r.role_id").Eq(goqu.I("our.role_id"))),
+		).
+		Where(goqu.Ex{"ou.organization_id": orgID}).
+		GroupBy(goqu.I("ou.organization_id"), goqu.I("ou.user_id"), goqu.I("ou.created_at")).
+		Order(goqu.I("ou.created_at").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := conn(ctx, m.DB).QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []*Membership{}
+
+	for rows.Next() {
+		var membership Membership
+		var roles []string
+
+		err := rows.Scan(&membership.OrganizationID, &membership.UserID, &membership.CreatedAt, pq.Array(&roles))
+		if err != nil {
+			return nil, err
+		}
+
+		membership.Roles = roles
+		members = append(members, &membership)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return members, nil
+}
+
+// AddMember adds the user to the organization (if they aren't a member yet) and grants
+// them the roles within the organization. It returns ErrRecordNotFound if the user
+// doesn't exist.
+func (m OrganizationModel) AddMember(ctx context.Context, orgID, userID uuid.UUID, roles ...string) error {
+	query, args, err := goqu.
+		Insert("organizations_users").
+		Rows(goqu.Record{"organization_id": orgID, "user_id": userID}).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	// the foreign key tells us whether the user exists, as the users outside the
+	// organization may be hidden by row level security
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		switch {
+		case isViolation(err, ConstraintForeignKey):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
+	if len(roles) == 0 {
+		return nil
+	}
+
+	query, args, err = goqu.
+		Insert("organizations_users_roles").
+		FromQuery(goqu.
+			Select(
+				goqu.V(orgID).As("organization_id"),
+				goqu.V(userID).As("user_id"),
+				goqu.I("roles.role_id").As("role_id"),
+			).
+			From("roles").
+			Where(
+				goqu.L("roles.code = ?", goqu.Any(pq.Array(roles))),
+				goqu.Ex{"roles.code": []string(OrganizationRoles)},
+			)).
+		OnConflict(goqu.DoNothing()).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	return err
+}
+
+// RemoveMember removes the user, and their roles, from the organization.
+func (m OrganizationModel) RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error {
+	query, args, err := goqu.
+		Delete("organizations_users").
+		Where(goqu.Ex{"organization_id": orgID, "user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (m OrganizationModel) getMemberRoles(ctx context.Context, orgID, userID uuid.UUID) (Roles, error) {
+	query, args, err := goqu.
+		Select(goqu.I("r.code")).
+		From(goqu.T("roles").As("r")).
+		Join(
+			goqu.T("organizations_users_roles").As("our"),
+			goqu.On(goqu.I("our.role_id").Eq(goqu.I("r.role_id"))),
+		).
+		Where(goqu.Ex{"our.organization_id": orgID, "our.user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	roles := Roles{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &roles, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
@@ -2,6 +2,7 @@ package data
 
 import (
 	"context"
+	"strings"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/google/uuid"
@@ -16,9 +17,12 @@ type Permission struct {
 
 type Permissions []string
 
+// Include reports whether any of the granted permissions matches the code. Granted
+// permissions may contain wildcards (see MatchPermission), so "users:*" includes
+// "users:list" and "*" includes everything.
 func (p Permissions) Include(code string) bool {
 	for i := range p {
-		if code == p[i] {
+		if MatchPermission(p[i], code) {
 			return true
 		}
 	}
@@ -26,63 +30,235 @@ func (p Permissions) Include(code string) bool {
 	return false
 }
 
+// IncludeMultiple reports whether all (or, when any is true, at least one) of the codes
+// are matched by the granted permissions.
 func (p Permissions) IncludeMultiple(codes []string, any bool) bool {
-	var count int = 0
-	for i := range p {
-		for j := range codes {
-			if codes[j] == p[i] {
-				count += 1
-				if any {
-					return true
-				}
-			}
+	for j := range codes {
+		included := p.Include(codes[j])
+
+		if any && included {
+			return true
+		}
+
+		if !any && !included {
+			return false
 		}
 	}
 
-	if any {
+	return !any
+}
+
+// MatchPermission reports whether the granted permission pattern matches the requested
+// code. Codes are made of segments separated by ":". A "*" segment in the middle of the
+// pattern matches exactly one segment, while a trailing "*" matches one or more
+// remaining segments. So "*" matches every code, "users:*" matches "users:list" and
+// "users:edit:own" (but not "users"), and "*:list" matches "users:list" and
+// "roles:list".
+func MatchPermission(granted, code string) bool {
+	if granted == code {
+		return true
+	}
+
+	if granted == "" || code == "" {
 		return false
 	}
 
-	return count == len(codes)
+	g := strings.Split(granted, ":")
+	c := strings.Split(code, ":")
+
+	for i := range g {
+		if i >= len(c) {
+			return false
+		}
+
+		if g[i] == "*" {
+			if i == len(g)-1 {
+				return true
+			}
+			continue
+		}
+
+		if g[i] != c[i] {
+			return false
+		}
+	}
+
+	return len(g) == len(c)
 }
 
 type PermissionModel struct {
-	DB        *sqlx.DB
+	DB        Conn
 	tableName string
 }
 
 func NewPermissionModel(db *sqlx.DB) PermissionModel {
 	return PermissionModel{
-		DB:        db,
+		DB:        Conn{pool: db},
 		tableName: "permissions",
 	}
 }
 
 func (m PermissionModel) GetAllForUser(ctx context.Context, userID uuid.UUID) (Permissions, error) {
-	query, args, err := goqu.
-		Select(goqu.I("p.code")).
-		From(goqu.T(m.tableName).As("p")).
-		LeftJoin(
-			goqu.T("users_permissions").As("up"),
-			goqu.On(goqu.I("up.permission_id").Eq(goqu.I("p.permission_id"))),
-		).
-		LeftJoin(
-			goqu.T("roles_permissions").As("rp"),
-			goqu.On(goqu.I("rp.permission_id").Eq(goqu.I("p.permission_id"))),
+	return m.getCodes(ctx, m.grantedPermissionIDs(userID))
+}
+
+// GetAllForUserInOrganization returns the permissions of the user while acting within
+// the organization: their global permissions plus the organization permissions of
+// their roles in the organization (see OrganizationRoles).
+func (m PermissionModel) GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Permissions, error) {
+	viaOrganizationRoles := goqu.
+		Select(goqu.I("rp.permission_id")).
+		From(goqu.T("roles_permissions").As("rp")).
+		Join(
+			goqu.T("organizations_users_roles").As("our"),
+			goqu.On(goqu.I("our.role_id").Eq(goqu.I("rp.role_id"))),
 		).
-		LeftJoin(
+		Join(goqu.T("roles").As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("rp.role_id")))).
+		Join(goqu.T(m.tableName).As("p"), goqu.On(goqu.I("p.permission_id").Eq(goqu.I("rp.permission_id")))).
+		Where(
+			goqu.Ex{"our.user_id": userID, "our.organization_id": orgID},
+			goqu.Ex{"r.code": []string(OrganizationRoles)},
+			goqu.I("p.code").Like(OrganizationPermissionPrefix+"%"),
+		)
+
+	return m.getCodes(ctx, m.grantedPermissionIDs(userID).Union(viaOrganizationRoles))
+}
+
+// GetAllByCode returns those of the codes which are permissions, to tell the unknown
+// ones apart.
+func (m PermissionModel) GetAllByCode(ctx context.Context, codes ...string) (Permissions, error) {
+	permissionIDs := goqu.
+		Select(goqu.I("p.permission_id")).
+		From(goqu.T(m.tableName).As("p")).
+		Where(goqu.L("p.code = ?", goqu.Any(pq.Array(codes))))
+
+	return m.getCodes(ctx, permissionIDs)
+}
+
+// GetAllForRoles returns the permissions granted by the roles.
+func (m PermissionModel) GetAllForRoles(ctx context.Context, roles ...string) (Permissions, error) {
+	permissionIDs := goqu.
+		Select(goqu.I("rp.permission_id")).
+		From(goqu.T("roles_permissions").As("rp")).
+		Join(goqu.T("roles").As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("rp.role_id")))).
+		Where(goqu.L("r.code = ?", goqu.Any(pq.Array(roles))))
+
+	return m.getCodes(ctx, permissionIDs)
+}
+
+// grantedPermissionIDs returns a query selecting the ids of the permissions granted to
+// the user, either directly, through their roles, through their groups or through the
+// roles of their groups.
+func (m PermissionModel) grantedPermissionIDs(userID uuid.UUID) *goqu.SelectDataset {
+	direct := goqu.
+		Select(goqu.I("up.permission_id")).
+		From(goqu.T("users_permissions").As("up")).
+		Where(goqu.Ex{"up.user_id": userID}, activeGrant("up"))
+
+	viaRoles := goqu.
+		Select(goqu.I("rp.permission_id")).
+		From(goqu.T("roles_permissions").As("rp")).
+		Join(
 			goqu.T("users_roles").As("ur"),
 			goqu.On(goqu.I("ur.role_id").Eq(goqu.I("rp.role_id"))),
 		).
-		Where(goqu.ExOr{"up.user_id": userID, "ur.user_id": userID}).
-		GroupBy(goqu.I("p.permission_id")).
+		Where(goqu.Ex{"ur.user_id": userID}, activeGrant("ur"))
+
+	viaGroups := goqu.
+		Select(goqu.I("gp.permission_id")).
+		From(goqu.T("groups_permissions").As("gp")).
+		Join(
+			goqu.T("groups_users").As("gu"),
+			goqu.On(goqu.I("gu.group_id").Eq(goqu.I("gp.group_id"))),
+		).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	viaGroupRoles := goqu.
+		Select(goqu.I("rp.permission_id")).
+		From(goqu.T("roles_permissions").As("rp")).
+		Join(
+			goqu.T("groups_roles").As("gr"),
+			goqu.On(goqu.I("gr.role_id").Eq(goqu.I("rp.role_id"))),
+		).
+		Join(
+			goqu.T("groups_users").As("gu"),
+			goqu.On(goqu.I("gu.group_id").Eq(goqu.I("gr.group_id"))),
+		).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	return direct.Union(viaRoles).Union(viaGroups).Union(viaGroupRoles)
+}
+
+// AccessGrant is a role or permission code held by a user and where it comes from:
+// "direct", "role:<code>", "group:<name>" or "group:<name>/role:<code>".
+type AccessGrant struct {
+	Code   string `json:"code" db:"code"`
+	Source string `json:"source" db:"source"`
+}
+
+// GetAccessForUser returns every permission of the user along with how it was granted.
+// A code is listed once per source.
+func (m PermissionModel) GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error) {
+	direct := goqu.
+		Select(goqu.I("p.code"), goqu.L("'direct'").As("source")).
+		From(goqu.T("users_permissions").As("up")).
+		Join(goqu.T(m.tableName).As("p"), goqu.On(goqu.I("p.permission_id").Eq(goqu.I("up.permission_id")))).
+		Where(goqu.Ex{"up.user_id": userID}, activeGrant("up"))
+
+	viaRoles := goqu.
+		Select(goqu.I("p.code"), goqu.L("'role:' || r.code").As("source")).
+		From(goqu.T("users_roles").As("ur")).
+		Join(goqu.T("roles").As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("ur.role_id")))).
+		Join(goqu.T("roles_permissions").As("rp"), goqu.On(goqu.I("rp.role_id").Eq(goqu.I("r.role_id")))).
+		Join(goqu.T(m.tableName).As("p"), goqu.On(goqu.I("p.permission_id").Eq(goqu.I("rp.permission_id")))).
+		Where(goqu.Ex{"ur.user_id": userID}, activeGrant("ur"))
+
+	viaGroups := goqu.
+		Select(goqu.I("p.code"), goqu.L("'group:' || g.name").As("source")).
+		From(goqu.T("groups_users").As("gu")).
+		Join(goqu.T("groups").As("g"), goqu.On(goqu.I("g.group_id").Eq(goqu.I("gu.group_id")))).
+		Join(goqu.T("groups_permissions").As("gp"), goqu.On(goqu.I("gp.group_id").Eq(goqu.I("g.group_id")))).
+		Join(goqu.T(m.tableName).As("p"), goqu.On(goqu.I("p.permission_id").Eq(goqu.I("gp.permission_id")))).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	viaGroupRoles := goqu.
+		Select(goqu.I("p.code"), goqu.L("'group:' || g.name || '/role:' || r.code").As("source")).
+		From(goqu.T("groups_users").As("gu")).
+		Join(goqu.T("groups").As("g"), goqu.On(goqu.I("g.group_id").Eq(goqu.I("gu.group_id")))).
+		Join(goqu.T("groups_roles").As("gr"), goqu.On(goqu.I("gr.group_id").Eq(goqu.I("g.group_id")))).
+		Join(goqu.T("roles").As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("gr.role_id")))).
+		Join(goqu.T("roles_permissions").As("rp"), goqu.On(goqu.I("rp.role_id").Eq(goqu.I("r.role_id")))).
+		Join(goqu.T(m.tableName).As("p"), goqu.On(goqu.I("p.permission_id").Eq(goqu.I("rp.permission_id")))).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	query, args, err := goqu.
+		From(direct.Union(viaRoles).Union(viaGroups).Union(viaGroupRoles).As("access")).
+		Order(goqu.I("code").Asc(), goqu.I("source").Asc()).
 		ToSQL()
+	if err != nil {
+		return nil, err
+	}
 
+	grants := []AccessGrant{}
+	err = readConn(ctx, m.DB).SelectContext(ctx, &grants, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	return grants, nil
+}
+
+func (m PermissionModel) getCodes(ctx context.Context, permissionIDs *goqu.SelectDataset) (Permissions, error) {
+	query, args, err := goqu.
+		Select(goqu.I("p.code")).
+		From(goqu.T(m.tableName).As("p")).
+		Where(goqu.I("p.permission_id").In(permissionIDs)).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := readConn(ctx, m.DB).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -108,26 +284,111 @@ func (m PermissionModel) GetAllForUser(ctx context.Context, userID uuid.UUID) (P
 }
 
 func (m PermissionModel) AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	return m.GrantForUser(ctx, userID, Grant{}, codes...)
+}
+
+// GrantForUser grants the permissions to the user for the period of the grant. Granting a
+// permission the user already has replaces the period and reason of the existing grant.
+func (m PermissionModel) GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error {
+	record := grantRecord(grant)
+
 	query, args, err := goqu.
 		Insert("users_permissions").
+		Cols("user_id", "permission_id", "valid_from", "valid_until", "reason").
 		FromQuery(goqu.
-			Select(goqu.V(userID).As("user_id"), goqu.I("permissions.permission_id").As("permission_id")).
+			Select(
+				goqu.V(userID).As("user_id"),
+				goqu.I("permissions.permission_id").As("permission_id"),
+				goqu.V(record["valid_from"]).As("valid_from"),
+				goqu.V(record["valid_until"]).As("valid_until"),
+				goqu.V(record["reason"]).As("reason"),
+			).
 			From(m.tableName).
 			Where(goqu.L("permissions.code = ?", goqu.Any(pq.Array(codes))))).
+		OnConflict(goqu.DoUpdate("user_id, permission_id", goqu.Record{
+			"valid_from":  goqu.I("excluded.valid_from"),
+			"valid_until": goqu.I("excluded.valid_until"),
+			"reason":      goqu.I("excluded.reason"),
+		})).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RevokeForUser removes the permissions granted directly to the user. It returns
+// ErrRecordNotFound if the user had none of them.
+func (m PermissionModel) RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	query, args, err := goqu.
+		Delete("users_permissions").
+		Where(
+			goqu.Ex{"user_id": userID},
+			goqu.I("permission_id").In(goqu.
+				Select("permission_id").
+				From(m.tableName).
+				Where(goqu.L("code = ?", goqu.Any(pq.Array(codes))))),
+		).
 		ToSQL()
+	if err != nil {
+		return err
+	}
 
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
 
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
+// DeleteExpiredGrants deletes the permissions granted to users whose validity period has
+// ended, and returns them. An audit event is written for each of them.
+func (m PermissionModel) DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error) {
+	expired := goqu.
+		Delete("users_permissions").
+		Where(goqu.I("valid_until").Lte(goqu.L("NOW()"))).
+		Returning("user_id", "permission_id", "valid_until", "reason")
+
+	query, args, err := goqu.
+		From(goqu.T("expired").As("e")).
+		With("expired", expired).
+		Select(goqu.I("e.user_id"), goqu.I("t.code"), goqu.I("e.valid_until"), goqu.I("e.reason")).
+		Join(goqu.T(m.tableName).As("t"), goqu.On(goqu.I("t.permission_id").Eq(goqu.I("e.permission_id")))).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []ExpiredGrant{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &grants, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditExpiredGrants(ctx, m.DB, "permission", grants)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
+
 func (m PermissionModel) AddForRole(ctx context.Context, roleID uuid.UUID, codes ...string) error {
 	query, args, err := goqu.
 		Insert("roles_permissions").
@@ -136,12 +397,11 @@ func (m PermissionModel) AddForRole(ctx context.Context, roleID uuid.UUID, codes
 			From(m.tableName).
 			Where(goqu.L("permissions.code = ?", goqu.Any(pq.Array(codes))))).
 		ToSQL()
-
 	if err != nil {
 		return err
 	}
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
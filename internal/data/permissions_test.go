@@ -0,0 +1,66 @@
+package data
+
+import "testing"
+
+func TestMatchPermission(t *testing.T) {
+	tests := []struct {
+		granted string
+		code    string
+		want    bool
+	}{
+		{"users:list", "users:list", true},
+		{"users:list", "users:edit", false},
+		{"users:*", "users:list", true},
+		{"users:*", "users:edit:own", true},
+		{"users:*", "users", false},
+		{"*", "users:list", true},
+		{"*", "users", true},
+		{"*:list", "users:list", true},
+		{"*:list", "roles:list", true},
+		{"*:list", "users:edit", false},
+		{"*:list", "users:list:own", false},
+		{"users", "users:list", false},
+		{"users:list", "users", false},
+		{"user:*", "users:list", false},
+		{"users:l", "users:list", false},
+		{"", "users:list", false},
+		{"users:list", "", false},
+	}
+
+	for _, tt := range tests {
+		got := MatchPermission(tt.granted, tt.code)
+		if got != tt.want {
+			t.Errorf("MatchPermission(%q, %q) = %v, want %v", tt.granted, tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestPermissionsIncludeMultiple(t *testing.T) {
+	tests := []struct {
+		name    string
+		granted Permissions
+		codes   []string
+		any     bool
+		want    bool
+	}{
+		{"all granted", Permissions{"users:list", "users:edit"}, []string{"users:list", "users:edit"}, false, true},
+		{"one missing", Permissions{"users:list"}, []string{"users:list", "users:edit"}, false, false},
+		{"any granted", Permissions{"users:list"}, []string{"users:edit", "users:list"}, true, true},
+		{"none granted", Permissions{"users:list"}, []string{"users:edit", "roles:list"}, true, false},
+		{"wildcard", Permissions{"users:*"}, []string{"users:list", "users:edit"}, false, true},
+		{"duplicate granted codes", Permissions{"users:list", "users:list"}, []string{"users:list", "users:edit"}, false, false},
+		{"duplicate requested codes", Permissions{"users:list"}, []string{"users:list", "users:list"}, false, true},
+		{"duplicate requested codes missing", Permissions{"users:edit", "users:edit"}, []string{"users:list", "users:list"}, false, false},
+		{"no codes", Permissions{"users:list"}, []string{}, false, true},
+		{"no codes any", Permissions{"users:list"}, []string{}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.granted.IncludeMultiple(tt.codes, tt.any)
+			if got != tt.want {
+				t.Errorf("%v.IncludeMultiple(%v, %v) = %v, want %v", tt.granted, tt.codes, tt.any, got, tt.want)
+			}
+		})
+	}
+}
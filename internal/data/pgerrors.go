@@ -0,0 +1,128 @@
+package data
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// The SQLSTATE codes translateError handles.
+const (
+	pgNotNullViolation     = "23502"
+	pgForeignKeyViolation  = "23503"
+	pgUniqueViolation      = "23505"
+	pgCheckViolation       = "23514"
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// The kinds of constraints of a ConstraintError.
+const (
+	ConstraintNotNull    = "not_null"
+	ConstraintForeignKey = "foreign_key"
+	ConstraintUnique     = "unique"
+	ConstraintCheck      = "check"
+)
+
+// ErrSerializationFailure is a transaction failing because of a concurrent one, a
+// serialization failure or a deadlock. It may succeed if run again.
+var ErrSerializationFailure = errors.New("serialization failure")
+
+// ConstraintError is a statement rejected for violating a constraint of the database.
+type ConstraintError struct {
+	Kind       string
+	Constraint string
+	Table      string
+	// the field the constraint is on, for the known constraints (see knownConstraints)
+	// and the not null violations
+	Field string
+	err   error
+}
+
+func (e *ConstraintError) Error() string {
+	return e.err.Error()
+}
+
+func (e *ConstraintError) Unwrap() error {
+	return e.err
+}
+
+// Is matches the error of the constraint if it is one of knownConstraints, so
+// errors.Is(err, ErrDuplicateEmail) holds for a violation of users_email_key.
+func (e *ConstraintError) Is(target error) bool {
+	c, ok := knownConstraints[e.Constraint]
+	return ok && c.err == target
+}
+
+// knownConstraints are the constraints the application tells apart, with the field
+// they are on and the error of their violation.
+var knownConstraints = map[string]struct {
+	field string
+	err   error
+}{
+	"users_email_key":    {field: "email", err: ErrDuplicateEmail},
+	"users_username_key": {field: "username", err: ErrDuplicateUsername},
+	"groups_name_key":    {field: "name", err: ErrDuplicateGroupName},
+}
+
+type serializationError struct {
+	err error
+}
+
+func (e serializationError) Error() string {
+	return e.err.Error()
+}
+
+func (e serializationError) Unwrap() error {
+	return e.err
+}
+
+func (e serializationError) Is(target error) bool {
+	return target == ErrSerializationFailure
+}
+
+// translateError turns the errors of PostgreSQL into a *ConstraintError or an
+// ErrSerializationFailure by their SQLSTATE, rather than by their message which
+// changes with the constraint names, the locale or the driver. The other errors are
+// returned as is.
+func translateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+
+	var kind string
+	switch pqErr.Code {
+	case pgNotNullViolation:
+		kind = ConstraintNotNull
+	case pgForeignKeyViolation:
+		kind = ConstraintForeignKey
+	case pgUniqueViolation:
+		kind = ConstraintUnique
+	case pgCheckViolation:
+		kind = ConstraintCheck
+	case pgSerializationFailure, pgDeadlockDetected:
+		return serializationError{err: err}
+	default:
+		return err
+	}
+
+	field := pqErr.Column
+	if c, ok := knownConstraints[pqErr.Constraint]; ok {
+		field = c.field
+	}
+
+	return &ConstraintError{
+		Kind:       kind,
+		Constraint: pqErr.Constraint,
+		Table:      pqErr.Table,
+		Field:      field,
+		err:        err,
+	}
+}
+
+// isViolation reports whether err is the violation of a constraint of the kind.
+func isViolation(err error, kind string) bool {
+	var constraintErr *ConstraintError
+	return errors.As(translateError(err), &constraintErr) && constraintErr.Kind == kind
+}
@@ -0,0 +1,168 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Replicas spreads the read-only queries of the models over read replicas of the
+// database, in turn among those which passed their last health check. The queries run
+// on the primary when no replica is healthy, and when the context comes from
+// ContextWithPrimary, which is how the clients read their own writes.
+type Replicas struct {
+	pools []*replicaPool
+	next  uint32
+	// how long the reads of a user go to the primary after they wrote, to outlast the
+	// replication lag
+	stickiness time.Duration
+
+	mu      sync.Mutex
+	writers map[uuid.UUID]time.Time
+}
+
+type replicaPool struct {
+	db      *sqlx.DB
+	healthy int32
+}
+
+// NewReplicas returns the Replicas of the connection pools, all of them healthy until
+// checked otherwise.
+func NewReplicas(dbs []*sqlx.DB, stickiness time.Duration) *Replicas {
+	r := &Replicas{
+		stickiness: stickiness,
+		writers:    map[uuid.UUID]time.Time{},
+	}
+
+	for _, db := range dbs {
+		r.pools = append(r.pools, &replicaPool{db: db, healthy: 1})
+	}
+
+	return r
+}
+
+// pick returns the next healthy replica, or nil if there is none.
+func (r *Replicas) pick() *sqlx.DB {
+	n := uint32(len(r.pools))
+	start := atomic.AddUint32(&r.next, 1)
+
+	for i := uint32(0); i < n; i++ {
+		pool := r.pools[(start+i)%n]
+		if atomic.LoadInt32(&pool.healthy) == 1 {
+			return pool.db
+		}
+	}
+
+	return nil
+}
+
+// CheckHealth pings the replicas, taking those which don't answer out of the rotation
+// until they answer again. It returns an error if any of them is unhealthy.
+func (r *Replicas) CheckHealth(ctx context.Context) error {
+	unhealthy := 0
+
+	for _, pool := range r.pools {
+		healthy := int32(1)
+		if err := pool.db.PingContext(ctx); err != nil {
+			healthy = 0
+			unhealthy++
+		}
+
+		atomic.StoreInt32(&pool.healthy, healthy)
+	}
+
+	if unhealthy > 0 {
+		return fmt.Errorf("%d of %d read replicas are unhealthy", unhealthy, len(r.pools))
+	}
+
+	return nil
+}
+
+// ReplicaStats is the state of the connection pool of a replica.
+type ReplicaStats struct {
+	Healthy bool `json:"healthy"`
+	sql.DBStats
+}
+
+// Stats returns the state of the connection pools of the replicas, in the order they
+// were given to NewReplicas.
+func (r *Replicas) Stats() []ReplicaStats {
+	stats := []ReplicaStats{}
+	for _, pool := range r.pools {
+		stats = append(stats, ReplicaStats{
+			Healthy: atomic.LoadInt32(&pool.healthy) == 1,
+			DBStats: pool.db.Stats(),
+		})
+	}
+
+	return stats
+}
+
+// Close closes the connection pools of the replicas.
+func (r *Replicas) Close() error {
+	var err error
+	for _, pool := range r.pools {
+		if closeErr := pool.db.Close(); closeErr != nil {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// NoteWrite records that the user wrote, so their reads go to the primary for a while
+// (see WroteRecently).
+func (r *Replicas) NoteWrite(userID uuid.UUID) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.writers[userID] = now
+
+	// forget the writes which are old enough, so the map doesn't grow forever
+	for id, t := range r.writers {
+		if now.Sub(t) > r.stickiness {
+			delete(r.writers, id)
+		}
+	}
+}
+
+// WroteRecently reports whether the user wrote within the stickiness period, in which
+// case their writes may not have reached the replicas yet.
+func (r *Replicas) WroteRecently(userID uuid.UUID) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.writers[userID]
+	return ok && time.Since(t) <= r.stickiness
+}
+
+const primaryContextKey = contextKey("primary")
+
+// ContextWithPrimary returns a copy of ctx whose model queries all run on the primary,
+// the read-only ones included.
+func ContextWithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryContextKey, true)
+}
+
+// readConn is conn for the read-only queries, which run on a replica if the models have
+// some and neither a transaction nor ctx requires the primary.
+func readConn(ctx context.Context, db Conn) DBTX {
+	if tx := currentTx(ctx); tx != nil {
+		return tx
+	}
+
+	if primary, _ := ctx.Value(primaryContextKey).(bool); db.replicas != nil && !primary {
+		if replica := db.replicas.pick(); replica != nil {
+			return replica
+		}
+	}
+
+	return db.pool
+}
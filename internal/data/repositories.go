@@ -0,0 +1,121 @@
+package data
+
+import (
+	"context"
+	"time"
+
+	"github.com/doug-martin/goqu/v9"
+	"github.com/google/uuid"
+)
+
+// The repositories are what Models holds. They are implemented by the models running
+// on PostgreSQL, and by the in-memory ones of NewMemoryModels.
+
+type UserRepository interface {
+	Insert(ctx context.Context, user *User) error
+	Get(ctx context.Context, id uuid.UUID) (*User, error)
+	GetByEmail(ctx context.Context, email string) (*User, error)
+	GetByUsername(ctx context.Context, username string) (*User, error)
+	GetForToken(ctx context.Context, tokenScope, tokenPlaintext string) (*User, error)
+	Update(ctx context.Context, user *User) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error)
+	GetAllDeleted(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error)
+	SetSuspension(ctx context.Context, user *User) error
+	UnsuspendExpired(ctx context.Context) ([]uuid.UUID, error)
+	Restore(ctx context.Context, id uuid.UUID) error
+	Purge(ctx context.Context, id uuid.UUID) error
+	PurgeDeleted(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error)
+	Erase(ctx context.Context, user *User) error
+}
+
+type TokenRepository interface {
+	New(ctx context.Context, userID uuid.UUID, ttl time.Duration, scope string) (*Token, error)
+	Insert(ctx context.Context, token *Token) error
+	DeleteAllForUser(ctx context.Context, scope string, userID uuid.UUID) error
+	GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Token, error)
+	RevokeAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type PermissionRepository interface {
+	GetAllForUser(ctx context.Context, userID uuid.UUID) (Permissions, error)
+	GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Permissions, error)
+	GetAllByCode(ctx context.Context, codes ...string) (Permissions, error)
+	GetAllForRoles(ctx context.Context, roles ...string) (Permissions, error)
+	GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error)
+	AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error
+	GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error
+	RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error
+	DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error)
+	AddForRole(ctx context.Context, roleID uuid.UUID, codes ...string) error
+}
+
+type RoleRepository interface {
+	GetAllForUser(ctx context.Context, userID uuid.UUID) (Roles, error)
+	GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Roles, error)
+	GetAllByCode(ctx context.Context, codes ...string) (Roles, error)
+	GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error)
+	AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error
+	GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error
+	RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error
+	DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error)
+}
+
+type OrganizationRepository interface {
+	Insert(ctx context.Context, org *Organization) error
+	Get(ctx context.Context, id uuid.UUID) (*Organization, error)
+	GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Organization, error)
+	Update(ctx context.Context, org *Organization) error
+	GetMembership(ctx context.Context, orgID, userID uuid.UUID) (*Membership, error)
+	GetMembers(ctx context.Context, orgID uuid.UUID) ([]*Membership, error)
+	AddMember(ctx context.Context, orgID, userID uuid.UUID, roles ...string) error
+	RemoveMember(ctx context.Context, orgID, userID uuid.UUID) error
+}
+
+type GroupRepository interface {
+	Insert(ctx context.Context, group *Group) error
+	Get(ctx context.Context, id uuid.UUID) (*Group, error)
+	GetAll(ctx context.Context) ([]*Group, error)
+	Update(ctx context.Context, group *Group) error
+	Delete(ctx context.Context, id uuid.UUID) error
+	SetAccess(ctx context.Context, groupID uuid.UUID, roles Roles, permissions Permissions) error
+	GetMemberIDs(ctx context.Context, groupID uuid.UUID) ([]uuid.UUID, error)
+	AddMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error
+	RemoveMembers(ctx context.Context, groupID uuid.UUID, userIDs ...uuid.UUID) error
+}
+
+type AuditRepository interface {
+	Record(ctx context.Context, action, targetType, targetID string, before, after interface{}) error
+	Insert(ctx context.Context, event *AuditEvent) error
+	GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*AuditEvent, Metadata, error)
+	VerifyChain(ctx context.Context) ([]AuditChainBreak, int, error)
+	Each(ctx context.Context, wheres []goqu.Expression, fn func(event *AuditEvent) error) error
+}
+
+type ExportRepository interface {
+	Insert(ctx context.Context, export *DataExport) error
+	Complete(ctx context.Context, export *DataExport) error
+	Fail(ctx context.Context, export *DataExport) error
+	GetLatestForUser(ctx context.Context, userID uuid.UUID) (*DataExport, error)
+	DeleteAllForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+var (
+	_ UserRepository         = UserModel{}
+	_ TokenRepository        = TokenModel{}
+	_ PermissionRepository   = PermissionModel{}
+	_ RoleRepository         = RoleModel{}
+	_ OrganizationRepository = OrganizationModel{}
+	_ GroupRepository        = GroupModel{}
+	_ AuditRepository        = AuditModel{}
+	_ ExportRepository       = ExportModel{}
+
+	_ UserRepository         = memoryUsers{}
+	_ TokenRepository        = memoryTokens{}
+	_ PermissionRepository   = memoryPermissions{}
+	_ RoleRepository         = memoryRoles{}
+	_ OrganizationRepository = memoryOrganizations{}
+	_ GroupRepository        = memoryGroups{}
+	_ AuditRepository        = memoryAudit{}
+	_ ExportRepository       = memoryExports{}
+)
@@ -26,54 +26,131 @@ func (r Roles) Include(code string) bool {
 	return false
 }
 
+// IncludeMultiple reports whether all (or, when any is true, at least one) of the codes
+// are among the roles.
 func (r Roles) IncludeMultiple(codes []string, any bool) bool {
-	var count int = 0
-	for i := range r {
-		for j := range codes {
-			if codes[j] == r[i] {
-				count += 1
-				if any {
-					return true
-				}
-			}
+	for j := range codes {
+		included := r.Include(codes[j])
+
+		if any && included {
+			return true
 		}
-	}
 
-	if any {
-		return false
+		if !any && !included {
+			return false
+		}
 	}
 
-	return count == len(codes)
+	return !any
 }
 
 type RoleModel struct {
-	DB        *sqlx.DB
+	DB        Conn
 	tableName string
 }
 
 func NewRoleModel(db *sqlx.DB) RoleModel {
 	return RoleModel{
-		DB:        db,
+		DB:        Conn{pool: db},
 		tableName: "roles",
 	}
 }
 
 func (m RoleModel) GetAllForUser(ctx context.Context, userID uuid.UUID) (Roles, error) {
-	query, args, err := goqu.
-		Select(goqu.I("p.code")).
-		From(goqu.T(m.tableName).As("p")).
+	return m.getCodes(ctx, m.grantedRoleIDs(userID))
+}
+
+// GetAllForUserInOrganization returns the global roles of the user plus their roles in
+// the organization, which are only ever OrganizationRoles.
+func (m RoleModel) GetAllForUserInOrganization(ctx context.Context, userID, orgID uuid.UUID) (Roles, error) {
+	viaOrganization := goqu.
+		Select(goqu.I("our.role_id")).
+		From(goqu.T("organizations_users_roles").As("our")).
+		Join(goqu.T(m.tableName).As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("our.role_id")))).
+		Where(
+			goqu.Ex{"our.user_id": userID, "our.organization_id": orgID},
+			goqu.Ex{"r.code": []string(OrganizationRoles)},
+		)
+
+	return m.getCodes(ctx, m.grantedRoleIDs(userID).Union(viaOrganization))
+}
+
+// GetAllByCode returns those of the codes which are roles, to tell the unknown ones
+// apart.
+func (m RoleModel) GetAllByCode(ctx context.Context, codes ...string) (Roles, error) {
+	roleIDs := goqu.
+		Select(goqu.I("r.role_id")).
+		From(goqu.T(m.tableName).As("r")).
+		Where(goqu.L("r.code = ?", goqu.Any(pq.Array(codes))))
+
+	return m.getCodes(ctx, roleIDs)
+}
+
+// grantedRoleIDs returns a query selecting the ids of the roles granted to the user,
+// either directly or through their groups.
+func (m RoleModel) grantedRoleIDs(userID uuid.UUID) *goqu.SelectDataset {
+	direct := goqu.
+		Select(goqu.I("ur.role_id")).
+		From(goqu.T("users_roles").As("ur")).
+		Where(goqu.Ex{"ur.user_id": userID}, activeGrant("ur"))
+
+	viaGroups := goqu.
+		Select(goqu.I("gr.role_id")).
+		From(goqu.T("groups_roles").As("gr")).
 		Join(
-			goqu.T("users_roles").As("up"),
-			goqu.On(goqu.I("up.role_id").Eq(goqu.I("p.permission_id"))),
+			goqu.T("groups_users").As("gu"),
+			goqu.On(goqu.I("gu.group_id").Eq(goqu.I("gr.group_id"))),
 		).
-		Where(goqu.Ex{"up.user_id": userID}).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	return direct.Union(viaGroups)
+}
+
+// GetAccessForUser returns every role of the user along with how it was granted
+// (see AccessGrant).
+func (m RoleModel) GetAccessForUser(ctx context.Context, userID uuid.UUID) ([]AccessGrant, error) {
+	direct := goqu.
+		Select(goqu.I("r.code"), goqu.L("'direct'").As("source")).
+		From(goqu.T("users_roles").As("ur")).
+		Join(goqu.T(m.tableName).As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("ur.role_id")))).
+		Where(goqu.Ex{"ur.user_id": userID}, activeGrant("ur"))
+
+	viaGroups := goqu.
+		Select(goqu.I("r.code"), goqu.L("'group:' || g.name").As("source")).
+		From(goqu.T("groups_users").As("gu")).
+		Join(goqu.T("groups").As("g"), goqu.On(goqu.I("g.group_id").Eq(goqu.I("gu.group_id")))).
+		Join(goqu.T("groups_roles").As("gr"), goqu.On(goqu.I("gr.group_id").Eq(goqu.I("g.group_id")))).
+		Join(goqu.T(m.tableName).As("r"), goqu.On(goqu.I("r.role_id").Eq(goqu.I("gr.role_id")))).
+		Where(goqu.Ex{"gu.user_id": userID})
+
+	query, args, err := goqu.
+		From(direct.Union(viaGroups).As("access")).
+		Order(goqu.I("code").Asc(), goqu.I("source").Asc()).
 		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []AccessGrant{}
+	err = readConn(ctx, m.DB).SelectContext(ctx, &grants, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
 
+func (m RoleModel) getCodes(ctx context.Context, roleIDs *goqu.SelectDataset) (Roles, error) {
+	query, args, err := goqu.
+		Select(goqu.I("r.code")).
+		From(goqu.T(m.tableName).As("r")).
+		Where(goqu.I("r.role_id").In(roleIDs)).
+		ToSQL()
 	if err != nil {
 		return nil, err
 	}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := readConn(ctx, m.DB).QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -99,22 +176,107 @@ func (m RoleModel) GetAllForUser(ctx context.Context, userID uuid.UUID) (Roles,
 }
 
 func (m RoleModel) AddForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	return m.GrantForUser(ctx, userID, Grant{}, codes...)
+}
+
+// GrantForUser grants the roles to the user for the period of the grant. Granting a
+// role the user already has replaces the period and reason of the existing grant.
+func (m RoleModel) GrantForUser(ctx context.Context, userID uuid.UUID, grant Grant, codes ...string) error {
+	record := grantRecord(grant)
+
 	query, args, err := goqu.
 		Insert("users_roles").
+		Cols("user_id", "role_id", "valid_from", "valid_until", "reason").
 		FromQuery(goqu.
-			Select(goqu.V(userID).As("user_id"), goqu.I("roles.role_id").As("role_id")).
+			Select(
+				goqu.V(userID).As("user_id"),
+				goqu.I("roles.role_id").As("role_id"),
+				goqu.V(record["valid_from"]).As("valid_from"),
+				goqu.V(record["valid_until"]).As("valid_until"),
+				goqu.V(record["reason"]).As("reason"),
+			).
 			From(m.tableName).
 			Where(goqu.L("roles.code = ?", goqu.Any(pq.Array(codes))))).
+		OnConflict(goqu.DoUpdate("user_id, role_id", goqu.Record{
+			"valid_from":  goqu.I("excluded.valid_from"),
+			"valid_until": goqu.I("excluded.valid_until"),
+			"reason":      goqu.I("excluded.reason"),
+		})).
 		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// RevokeForUser removes the roles granted directly to the user. It returns
+// ErrRecordNotFound if the user had none of them.
+func (m RoleModel) RevokeForUser(ctx context.Context, userID uuid.UUID, codes ...string) error {
+	query, args, err := goqu.
+		Delete("users_roles").
+		Where(
+			goqu.Ex{"user_id": userID},
+			goqu.I("role_id").In(goqu.
+				Select("role_id").
+				From(m.tableName).
+				Where(goqu.L("code = ?", goqu.Any(pq.Array(codes))))),
+		).
+		ToSQL()
 	if err != nil {
 		return err
 	}
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
 
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
+
+// DeleteExpiredGrants deletes the roles granted to users whose validity period has
+// ended, and returns them. An audit event is written for each of them.
+func (m RoleModel) DeleteExpiredGrants(ctx context.Context) ([]ExpiredGrant, error) {
+	expired := goqu.
+		Delete("users_roles").
+		Where(goqu.I("valid_until").Lte(goqu.L("NOW()"))).
+		Returning("user_id", "role_id", "valid_until", "reason")
+
+	query, args, err := goqu.
+		From(goqu.T("expired").As("e")).
+		With("expired", expired).
+		Select(goqu.I("e.user_id"), goqu.I("t.code"), goqu.I("e.valid_until"), goqu.I("e.reason")).
+		Join(goqu.T(m.tableName).As("t"), goqu.On(goqu.I("t.role_id").Eq(goqu.I("e.role_id")))).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	grants := []ExpiredGrant{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &grants, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = auditExpiredGrants(ctx, m.DB, "role", grants)
+	if err != nil {
+		return nil, err
+	}
+
+	return grants, nil
+}
@@ -16,6 +16,7 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	ScopeExport         = "export"
 )
 
 type Token struct {
@@ -55,17 +56,18 @@ func ValidateTokenPlaintext(v *validator.Validator, tokenPlaintext string) {
 }
 
 type TokenModel struct {
-	DB        *sqlx.DB
+	DB        Conn
 	tableName string
 }
 
 func NewTokenModel(db *sqlx.DB) TokenModel {
 	return TokenModel{
-		DB:        db,
+		DB:        Conn{pool: db},
 		tableName: "tokens",
 	}
 }
 
+// New generates a token for the user and inserts it, along with an audit event.
 func (m TokenModel) New(ctx context.Context, userID uuid.UUID, ttl time.Duration, scope string) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
@@ -73,6 +75,19 @@ func (m TokenModel) New(ctx context.Context, userID uuid.UUID, ttl time.Duration
 	}
 
 	err = m.Insert(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertAuditEvent(ctx, m.DB, &AuditEvent{
+		Action:     AuditTokenCreate,
+		TargetType: AuditTargetUser,
+		TargetID:   userID.String(),
+		Changes: AuditChanges{
+			"scope":  {After: scope},
+			"expiry": {After: token.Expiry},
+		},
+	})
 	return token, err
 }
 
@@ -90,7 +105,7 @@ func (m TokenModel) Insert(ctx context.Context, token *Token) error {
 		return err
 	}
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	return err
 }
 
@@ -106,6 +121,44 @@ func (m TokenModel) DeleteAllForUser(ctx context.Context, scope string, userID u
 		return err
 	}
 
-	_, err = m.DB.ExecContext(ctx, query, args...)
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAllForUser returns the unexpired tokens of the user, without their hashes.
+func (m TokenModel) GetAllForUser(ctx context.Context, userID uuid.UUID) ([]*Token, error) {
+	query, args, err := goqu.
+		Select("user_id", "scope", "expiry").
+		From(m.tableName).
+		Where(
+			goqu.Ex{"user_id": userID},
+			goqu.I("expiry").Gt(time.Now()),
+		).
+		Order(goqu.I("expiry").Asc()).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := []*Token{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &tokens, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// RevokeAllForUser deletes the tokens of the user in every scope.
+func (m TokenModel) RevokeAllForUser(ctx context.Context, userID uuid.UUID) error {
+	query, args, err := goqu.
+		Delete(m.tableName).
+		Where(goqu.Ex{"user_id": userID}).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	_, err = conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	return err
 }
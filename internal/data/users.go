@@ -7,7 +7,9 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
+	"unicode"
 
 	"github.com/doug-martin/goqu/v9"
 	"github.com/google/uuid"
@@ -18,9 +20,17 @@ import (
 )
 
 var (
-	ErrDuplicateEmail = errors.New("duplicate email")
+	ErrDuplicateEmail    = errors.New("duplicate email")
+	ErrDuplicateUsername = errors.New("duplicate username")
 )
 
+// ReservedUsernames can't be registered, so they can't be mistaken for the application
+// or its staff. They are compared case-insensitively.
+var ReservedUsernames = []string{
+	"admin", "administrator", "anonymous", "api", "erased", "help", "me",
+	"null", "root", "staff", "superuser", "support", "system",
+}
+
 var AnonymousUser = &User{}
 
 type User struct {
@@ -37,12 +47,40 @@ type User struct {
 	IsSuperuser bool        `json:"is_superuser" db:"is_superuser"`
 	LastLogin   null.Time   `json:"last_login" db:"last_login"`
 	Version     int         `json:"-" db:"version"`
+	ErasedAt    null.Time   `json:"erased_at" db:"erased_at"`
+	// how well the user matches the search of a listing
+	Rank float64 `json:"rank,omitempty" db:"rank"`
+	Suspension
+}
+
+// Suspension is why, by whom and until when a user is suspended. A suspended user can't
+// log in or use their tokens.
+type Suspension struct {
+	SuspendedAt      null.Time     `json:"suspended_at" db:"suspended_at"`
+	SuspendedUntil   null.Time     `json:"suspended_until" db:"suspended_until"`
+	SuspensionReason string        `json:"suspension_reason" db:"suspension_reason"`
+	SuspendedBy      uuid.NullUUID `json:"suspended_by" db:"suspended_by"`
 }
 
 func (u *User) IsAnonymousUser() bool {
 	return u == AnonymousUser
 }
 
+// OwnerID returns the user the record belongs to, which for a user is itself.
+func (u *User) OwnerID() uuid.UUID {
+	return u.UserID
+}
+
+// IsSuspended reports whether the user is suspended. Suspensions end by themselves once
+// their expiry has passed.
+func (u *User) IsSuspended() bool {
+	if !u.SuspendedAt.Valid {
+		return false
+	}
+
+	return !u.SuspendedUntil.Valid || u.SuspendedUntil.Time.After(time.Now())
+}
+
 type password struct {
 	plaintext *string
 	hash      []byte
@@ -89,15 +127,13 @@ func (p *password) Set(plaintextPassword string) error {
 	return nil
 }
 
+// Matches reports whether the plaintext password is the one hashed. A malformed hash,
+// like the placeholder of the erased users, matches no password: comparing with bcrypt
+// only fails on a mismatch or on a hash it can't parse, so it never returns an error.
 func (p *password) Matches(plaintextPassword string) (bool, error) {
 	err := bcrypt.CompareHashAndPassword(p.hash, []byte(plaintextPassword))
 	if err != nil {
-		switch {
-		case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
-			return false, nil
-		default:
-			return false, err
-		}
+		return false, nil
 	}
 
 	return true, nil
@@ -108,17 +144,36 @@ func ValidateEmail(v *validator.Validator, email string) {
 	v.Check(validator.Matches(email, validator.EmailRX), "email", "must be a valid email address")
 }
 
+func ValidateUsername(v *validator.Validator, username string) {
+	v.Check(username != "", "username", "must be provided")
+	v.Check(len(username) >= 3, "username", "must be at least 3 bytes long")
+	v.Check(len(username) <= 150, "username", "must not be more than 150 bytes long")
+	v.Check(validator.Matches(username, validator.UsernameRX), "username", "must only contain letters and digits, separated by dots, dashes or underscores")
+	v.Check(!validator.In(strings.ToLower(username), ReservedUsernames...), "username", "is reserved")
+	// the placeholder of erased users
+	v.Check(!strings.HasPrefix(strings.ToLower(username), "erased-"), "username", "is reserved")
+}
+
 func ValidatePasswordPlaintext(v *validator.Validator, password string) {
 	v.Check(password != "", "password", "must be provided")
 	v.Check(len(password) >= 8, "password", "must be at least 8 bytes long")
 	v.Check(len(password) <= 72, "password", "must not be more than 72 bytes long")
 }
 
+func ValidateSuspension(v *validator.Validator, suspension Suspension) {
+	v.Check(suspension.SuspensionReason != "", "reason", "must be provided")
+	v.Check(len(suspension.SuspensionReason) <= 500, "reason", "must not be more than 500 bytes long")
+	if suspension.SuspendedUntil.Valid {
+		v.Check(suspension.SuspendedUntil.Time.After(time.Now()), "until", "must be in the future")
+	}
+}
+
 func ValidateUser(v *validator.Validator, user *User) {
 	v.Check(user.FirstName != "", "first_name", "must be provided")
 	v.Check(len(user.FirstName) <= 500, "first_name", "must not be more than 500 bytes long")
 
 	ValidateEmail(v, user.Email)
+	ValidateUsername(v, user.Username.String)
 
 	if user.Password.plaintext != nil {
 		ValidatePasswordPlaintext(v, *user.Password.plaintext)
@@ -130,13 +185,13 @@ func ValidateUser(v *validator.Validator, user *User) {
 }
 
 type UserModel struct {
-	DB        *sqlx.DB
+	DB        Conn
 	tableName string
 }
 
 func NewUserModel(db *sqlx.DB) UserModel {
 	return UserModel{
-		DB:        db,
+		DB:        Conn{pool: db},
 		tableName: "users",
 	}
 }
@@ -164,22 +219,38 @@ func (m UserModel) Insert(ctx context.Context, user *User) error {
 		return err
 	}
 
-	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.UserID, &user.CreatedAt, &user.UpdatedAt, &user.Version)
+	// a duplicate email address or username is an ErrDuplicateEmail or
+	// ErrDuplicateUsername (see knownConstraints)
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&user.UserID, &user.CreatedAt, &user.UpdatedAt, &user.Version)
 	if err != nil {
-		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
-		default:
-			return err
-		}
+		return translateError(err)
 	}
 
 	return nil
 }
 
+// userColumns returns the columns of a user, qualified with the alias if there is one.
+// The search columns aren't part of them.
+func userColumns(alias string) []interface{} {
+	columns := []interface{}{}
+	for _, column := range []string{
+		"user_id", "created_at", "updated_at", "deleted_at",
+		"first_name", "last_name", "username", "email", "password",
+		"is_active", "is_staff", "is_superuser", "last_login", "version", "erased_at",
+		"suspended_at", "suspended_until", "suspension_reason", "suspended_by",
+	} {
+		if alias != "" {
+			column = alias + "." + column
+		}
+		columns = append(columns, goqu.I(column))
+	}
+
+	return columns
+}
+
 func (m UserModel) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	query, args, err := goqu.
-		Select("*").
+		Select(userColumns("")...).
 		From(m.tableName).
 		Where(goqu.Ex{"user_id": id, "deleted_at": nil}).
 		ToSQL()
@@ -188,7 +259,7 @@ func (m UserModel) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	}
 
 	var user User
-	err = m.DB.GetContext(ctx, &user, query, args...)
+	err = readConn(ctx, m.DB).GetContext(ctx, &user, query, args...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -201,18 +272,51 @@ func (m UserModel) Get(ctx context.Context, id uuid.UUID) (*User, error) {
 	return &user, nil
 }
 
+// GetByEmail returns the user with the email address, ignoring case like the
+// users_email_key index.
 func (m UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query, args, err := goqu.
-		Select("*").
+		Select(userColumns("")...).
 		From(m.tableName).
-		Where(goqu.Ex{"email": email, "deleted_at": nil}).
+		Where(
+			goqu.Func("lower", goqu.I("email")).Eq(strings.ToLower(email)),
+			goqu.Ex{"deleted_at": nil},
+		).
 		ToSQL()
 	if err != nil {
 		return nil, err
 	}
 
 	var user User
-	err = m.DB.GetContext(ctx, &user, query, args...)
+	err = conn(ctx, m.DB).GetContext(ctx, &user, query, args...)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &user, nil
+}
+
+// GetByUsername returns the user with the username, ignoring case.
+func (m UserModel) GetByUsername(ctx context.Context, username string) (*User, error) {
+	query, args, err := goqu.
+		Select(userColumns("")...).
+		From(m.tableName).
+		Where(
+			goqu.Func("lower", goqu.I("username")).Eq(strings.ToLower(username)),
+			goqu.Ex{"deleted_at": nil},
+		).
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = conn(ctx, m.DB).GetContext(ctx, &user, query, args...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -229,7 +333,7 @@ func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext s
 	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
 
 	query, args, err := goqu.
-		Select(goqu.I("u.*")).
+		Select(userColumns("u")...).
 		From(goqu.T(m.tableName).As("u")).
 		Join(goqu.T("tokens").As("t"), goqu.On(
 			goqu.I("t.user_id").Eq(goqu.I("u.user_id")))).
@@ -245,7 +349,7 @@ func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext s
 	}
 
 	var user User
-	err = m.DB.GetContext(ctx, &user, query, args...)
+	err = conn(ctx, m.DB).GetContext(ctx, &user, query, args...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -260,9 +364,11 @@ func (m UserModel) GetForToken(ctx context.Context, tokenScope, tokenPlaintext s
 
 func (m UserModel) Update(ctx context.Context, user *User) error {
 	data := map[string]interface{}{
-		"is_active":  user.IsActive,
-		"version":    user.Version + 1,
-		"updated_at": time.Now(),
+		"is_active":    user.IsActive,
+		"is_staff":     user.IsStaff,
+		"is_superuser": user.IsSuperuser,
+		"version":      user.Version + 1,
+		"updated_at":   time.Now(),
 	}
 	if user.Password.hash != nil {
 		data["password"] = user.Password.hash
@@ -279,9 +385,6 @@ func (m UserModel) Update(ctx context.Context, user *User) error {
 	if user.Username.Valid {
 		data["username"] = user.Username
 	}
-	if user.IsSuperuser {
-		data["is_superuser"] = user.IsSuperuser
-	}
 
 	query, args, err := goqu.
 		Update(m.tableName).
@@ -297,15 +400,13 @@ func (m UserModel) Update(ctx context.Context, user *User) error {
 		return err
 	}
 
-	err = m.DB.QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&user.Version)
 	if err != nil {
 		switch {
-		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
-			return ErrDuplicateEmail
 		case errors.Is(err, sql.ErrNoRows):
 			return ErrEditConflict
 		default:
-			return err
+			return translateError(err)
 		}
 	}
 
@@ -326,7 +427,7 @@ func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
 		return err
 	}
 
-	result, err := m.DB.ExecContext(ctx, query, args...)
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
 	if err != nil {
 		return err
 	}
@@ -343,32 +444,70 @@ func (m UserModel) Delete(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// UserListColumns are the columns of the users fetched by GetAll, which Filters.Fields
+// can narrow down.
+var UserListColumns = []string{
+	"user_id", "created_at", "updated_at", "deleted_at",
+	"email", "username",
+	"first_name", "last_name",
+	"is_active", "is_staff", "is_superuser", "version",
+}
+
 func (m UserModel) GetAll(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
-	sel := goqu.Select(
-		goqu.COUNT("*").Over(goqu.W()),
-		"user_id", "created_at", "updated_at",
-		"email", "username",
-		"first_name", "last_name",
-		"is_active", "is_staff", "is_superuser", "version",
-	).
-		From(m.tableName).
-		Where(goqu.Ex{"deleted_at": nil})
+	return m.getAll(ctx, goqu.Ex{"deleted_at": nil}, wheres, filters)
+}
 
-	for i := range wheres {
-		sel.Where(wheres[i])
+// GetAllDeleted is GetAll for the soft-deleted users.
+func (m UserModel) GetAllDeleted(ctx context.Context, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
+	return m.getAll(ctx, goqu.I("deleted_at").IsNotNull(), wheres, filters)
+}
+
+func (m UserModel) getAll(ctx context.Context, deleted goqu.Expression, wheres []goqu.Expression, filters Filters) ([]*User, Metadata, error) {
+	p, err := filters.pagination("user_id")
+	if err != nil {
+		return nil, Metadata{}, err
 	}
 
-	if filters.Sort != "" {
-		if filters.sortDirection() == "DESC" {
-			sel = sel.Order(goqu.I(filters.sortColumn()).Desc())
-		} else {
-			sel = sel.Order(goqu.I(filters.sortColumn()).Asc())
+	base := goqu.From(m.tableName)
+	if filters.Search != "" {
+		base = goqu.From(m.search(filters.Search).As(m.tableName))
+	}
+	base = base.Where(deleted).Where(wheres...)
+
+	// Declare a totalRecords variable.
+	totalRecords := 0
+
+	if p.countSeparately() {
+		query, args, err := base.Select(goqu.COUNT("*")).ToSQL()
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		err = readConn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&totalRecords)
+		if err != nil {
+			return nil, Metadata{}, err
 		}
 	}
 
-	if filters.limit() > 0 && filters.Page > 0 {
-		sel = sel.Limit(uint(filters.limit())).
-			Offset(uint(filters.offset()))
+	columns := []interface{}{}
+	for _, column := range p.columns(UserListColumns) {
+		columns = append(columns, column)
+	}
+	if p.countOver() {
+		columns = append([]interface{}{goqu.COUNT("*").Over(goqu.W())}, columns...)
+	}
+	if filters.Search != "" {
+		columns = append(columns, "rank")
+	}
+
+	sel := base.Select(columns...).Order(p.order()...)
+
+	if where := p.where(); where != nil {
+		sel = sel.Where(where)
+	}
+
+	if p.paged() {
+		sel = sel.Limit(p.limit()).Offset(p.offset())
 	}
 
 	query, args, err := sel.ToSQL()
@@ -376,7 +515,7 @@ func (m UserModel) GetAll(ctx context.Context, wheres []goqu.Expression, filters
 		return nil, Metadata{}, err
 	}
 
-	rows, err := m.DB.QueryContext(ctx, query, args...)
+	rows, err := readConn(ctx, m.DB).QueryContext(ctx, query, args...)
 	if err != nil {
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
@@ -388,27 +527,39 @@ func (m UserModel) GetAll(ctx context.Context, wheres []goqu.Expression, filters
 
 	defer rows.Close()
 
-	// Declare a totalRecords variable.
-	totalRecords := 0
 	users := []*User{}
 
 	for rows.Next() {
 		var user User
 
-		err := rows.Scan(
-			&totalRecords, // Scan the count from the window function into totalRecords.
-			&user.UserID,
-			&user.CreatedAt,
-			&user.UpdatedAt,
-			&user.Email,
-			&user.Username,
-			&user.FirstName,
-			&user.LastName,
-			&user.IsActive,
-			&user.IsStaff,
-			&user.IsSuperuser,
-			&user.Version,
-		)
+		fields := map[string]interface{}{
+			"user_id":      &user.UserID,
+			"created_at":   &user.CreatedAt,
+			"updated_at":   &user.UpdatedAt,
+			"deleted_at":   &user.RemovedAt,
+			"email":        &user.Email,
+			"username":     &user.Username,
+			"first_name":   &user.FirstName,
+			"last_name":    &user.LastName,
+			"is_active":    &user.IsActive,
+			"is_staff":     &user.IsStaff,
+			"is_superuser": &user.IsSuperuser,
+			"version":      &user.Version,
+		}
+
+		dest := []interface{}{}
+		for _, column := range p.columns(UserListColumns) {
+			dest = append(dest, fields[column])
+		}
+		if p.countOver() {
+			// Scan the count from the window function into totalRecords.
+			dest = append([]interface{}{&totalRecords}, dest...)
+		}
+		if filters.Search != "" {
+			dest = append(dest, &user.Rank)
+		}
+
+		err := rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err // Update this to return an empty Metadata struct.
 		}
@@ -420,5 +571,266 @@ func (m UserModel) GetAll(ctx context.Context, wheres []goqu.Expression, filters
 		return nil, Metadata{}, err // Update this to return an empty Metadata struct.
 	}
 
-	return users, calculateMetadata(totalRecords, filters.Page, filters.PageSize), nil
+	n, metadata, err := p.finish(users, totalRecords)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	return users[:n], metadata, nil
+}
+
+// search returns a query selecting the users matching the search, ranked by how well
+// they match. The words of the search match the beginning of the words of the names,
+// username and email address, and misspelled words are caught by their similarity
+// (see the add_users_search migration).
+func (m UserModel) search(search string) *goqu.SelectDataset {
+	words := searchWords(search)
+	for i := range words {
+		words[i] += ":*"
+	}
+	tsquery := goqu.L("to_tsquery('simple', ?)", strings.Join(words, " & "))
+	text := strings.ToLower(search)
+
+	return goqu.
+		From(m.tableName).
+		Select(
+			goqu.Star(),
+			goqu.L("(ts_rank(search, ?) + word_similarity(?, search_text))::float8", tsquery, text).As("rank"),
+		).
+		Where(goqu.Or(
+			goqu.L("search @@ ?", tsquery),
+			goqu.L("? <% search_text", text),
+		))
+}
+
+// searchWords splits the search into lowercase words of letters and digits.
+func searchWords(search string) []string {
+	return strings.FieldsFunc(strings.ToLower(search), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// SetSuspension writes the suspension of the user, suspending them if SuspendedAt is set
+// and lifting the suspension otherwise.
+func (m UserModel) SetSuspension(ctx context.Context, user *User) error {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"suspended_at":      user.SuspendedAt,
+			"suspended_until":   user.SuspendedUntil,
+			"suspension_reason": user.SuspensionReason,
+			"suspended_by":      user.SuspendedBy,
+			"version":           user.Version + 1,
+			"updated_at":        time.Now(),
+		}).
+		Where(goqu.Ex{
+			"user_id":    user.UserID,
+			"version":    user.Version,
+			"deleted_at": nil,
+		}).
+		Returning("version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UnsuspendExpired lifts the suspensions whose expiry has passed, writing an audit event
+// for each, and returns the ids of the users.
+func (m UserModel) UnsuspendExpired(ctx context.Context) ([]uuid.UUID, error) {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"suspended_at":      nil,
+			"suspended_until":   nil,
+			"suspension_reason": "",
+			"suspended_by":      nil,
+			"version":           goqu.L("version + 1"),
+			"updated_at":        time.Now(),
+		}).
+		Where(
+			goqu.I("suspended_at").IsNotNull(),
+			goqu.I("suspended_until").Lte(goqu.L("NOW()")),
+		).
+		Returning("user_id").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []uuid.UUID{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &userIDs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range userIDs {
+		err = insertAuditEvent(ctx, m.DB, &AuditEvent{
+			Action:     AuditUserUnsuspend,
+			TargetType: AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    AuditChanges{"suspension": {Before: "expired"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userIDs, nil
+}
+
+// Restore undoes the soft-delete of the user. It returns ErrDuplicateEmail or
+// ErrDuplicateUsername if another user has taken their email address or username since.
+func (m UserModel) Restore(ctx context.Context, id uuid.UUID) error {
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"deleted_at": nil,
+			"version":    goqu.L("version + 1"),
+			"updated_at": time.Now(),
+		}).
+		Where(
+			goqu.Ex{"user_id": id},
+			goqu.I("deleted_at").IsNotNull(),
+		).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return translateError(err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// Purge permanently removes the soft-deleted user, along with their tokens, roles,
+// permissions and memberships.
+func (m UserModel) Purge(ctx context.Context, id uuid.UUID) error {
+	query, args, err := goqu.
+		Delete(m.tableName).
+		Where(
+			goqu.Ex{"user_id": id},
+			goqu.I("deleted_at").IsNotNull(),
+		).
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	result, err := conn(ctx, m.DB).ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// PurgeDeleted permanently removes the users soft-deleted before the cutoff, writing an
+// audit event for each, and returns their ids.
+func (m UserModel) PurgeDeleted(ctx context.Context, cutoff time.Time) ([]uuid.UUID, error) {
+	query, args, err := goqu.
+		Delete(m.tableName).
+		Where(goqu.I("deleted_at").Lt(cutoff)).
+		Returning("user_id").
+		ToSQL()
+	if err != nil {
+		return nil, err
+	}
+
+	userIDs := []uuid.UUID{}
+	err = conn(ctx, m.DB).SelectContext(ctx, &userIDs, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range userIDs {
+		err = insertAuditEvent(ctx, m.DB, &AuditEvent{
+			Action:     AuditUserPurge,
+			TargetType: AuditTargetUser,
+			TargetID:   id.String(),
+			Changes:    AuditChanges{"retention": {Before: "expired"}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return userIDs, nil
+}
+
+// Erase anonymizes the personal data of the user. The row is kept, so whatever refers
+// to the user stays valid, and the user can't log in anymore.
+func (m UserModel) Erase(ctx context.Context, user *User) error {
+	placeholder := "erased-" + user.UserID.String()
+
+	query, args, err := goqu.
+		Update(m.tableName).
+		Set(goqu.Record{
+			"first_name":        "Erased",
+			"last_name":         nil,
+			"username":          placeholder,
+			"email":             placeholder + "@erased.invalid",
+			"password":          "!",
+			"is_active":         false,
+			"last_login":        nil,
+			"suspension_reason": "",
+			"erased_at":         time.Now(),
+			"version":           user.Version + 1,
+			"updated_at":        time.Now(),
+		}).
+		Where(goqu.Ex{
+			"user_id":   user.UserID,
+			"version":   user.Version,
+			"erased_at": nil,
+		}).
+		Returning("version").
+		ToSQL()
+	if err != nil {
+		return err
+	}
+
+	err = conn(ctx, m.DB).QueryRowContext(ctx, query, args...).Scan(&user.Version)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,37 @@
+package data
+
+import "testing"
+
+func TestPasswordMatches(t *testing.T) {
+	var hashed password
+	err := hashed.Set("pa55word1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		password  password
+		plaintext string
+		want      bool
+	}{
+		{"matching", hashed, "pa55word1234", true},
+		{"not matching", hashed, "wrongpa55word", false},
+		{"erased placeholder", password{hash: []byte("!")}, "!", false},
+		{"not a bcrypt hash", password{hash: []byte("$1$notbcrypt$0000000000000000000000000000000000000000000000000000")}, "pa55word1234", false},
+		{"no hash", password{}, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.password.Matches(tt.plaintext)
+			if err != nil {
+				t.Fatalf("Matches(%q) returned an error: %v", tt.plaintext, err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Matches(%q) = %v, want %v", tt.plaintext, got, tt.want)
+			}
+		})
+	}
+}
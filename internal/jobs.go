@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hasahmad/go-skeleton/internal/data"
+	log "github.com/sirupsen/logrus"
+)
+
+// startJobs launches the periodic background jobs. They stop when the server shuts down.
+func (app *Application) startJobs() {
+	if app.cfg.Jobs.GrantSweepInterval > 0 {
+		app.runPeriodically("sweep expired grants", app.cfg.Jobs.GrantSweepInterval, app.sweepExpiredGrants)
+	}
+	if app.cfg.Jobs.SuspensionSweepInterval > 0 {
+		app.runPeriodically("sweep expired suspensions", app.cfg.Jobs.SuspensionSweepInterval, app.sweepExpiredSuspensions)
+	}
+	if app.cfg.Jobs.UserPurgeInterval > 0 {
+		app.runPeriodically("purge deleted users", app.cfg.Jobs.UserPurgeInterval, app.purgeDeletedUsers)
+	}
+	if app.models.Replicas != nil && app.cfg.DB.ReplicaCheckInterval > 0 {
+		app.runPeriodically("check read replicas", app.cfg.DB.ReplicaCheckInterval, app.models.Replicas.CheckHealth)
+	}
+}
+
+// runPeriodically runs fn every interval in a background goroutine until the quit
+// channel is closed. Graceful shutdown waits for a run which is in progress.
+func (app *Application) runPeriodically(name string, interval time.Duration, fn func(ctx context.Context) error) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.quit:
+				return
+			case <-ticker.C:
+			}
+
+			func() {
+				// Recover any panic so one failed run doesn't stop the job.
+				defer func() {
+					if err := recover(); err != nil {
+						app.logger.WithFields(log.Fields{"job": name}).Errorf("%s", err)
+					}
+				}()
+
+				ctx, cancel := context.WithTimeout(context.Background(), interval)
+				defer cancel()
+
+				err := fn(ctx)
+				if err != nil {
+					app.logger.WithFields(log.Fields{"job": name}).Error(err)
+				}
+			}()
+		}
+	}()
+}
+
+// sweepExpiredGrants deletes the role and permission grants whose validity period has
+// ended.
+func (app *Application) sweepExpiredGrants(ctx context.Context) error {
+	var roles, permissions []data.ExpiredGrant
+
+	// the grants are deleted along with their audit events
+	err := app.models.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+
+		roles, err = app.models.Roles.DeleteExpiredGrants(ctx)
+		if err != nil {
+			return err
+		}
+
+		permissions, err = app.models.Permissions.DeleteExpiredGrants(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, grant := range roles {
+		app.logger.WithFields(log.Fields{
+			"user_id":     grant.UserID,
+			"role":        grant.Code,
+			"valid_until": grant.ValidUntil,
+			"reason":      grant.Reason,
+		}).Info("expired role grant removed")
+	}
+
+	for _, grant := range permissions {
+		app.logger.WithFields(log.Fields{
+			"user_id":     grant.UserID,
+			"permission":  grant.Code,
+			"valid_until": grant.ValidUntil,
+			"reason":      grant.Reason,
+		}).Info("expired permission grant removed")
+	}
+
+	return nil
+}
+
+// sweepExpiredSuspensions lifts the user suspensions whose expiry has passed. The users
+// can log in again as soon as it passes, this cleans up their records.
+func (app *Application) sweepExpiredSuspensions(ctx context.Context) error {
+	var userIDs []uuid.UUID
+
+	err := app.models.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		userIDs, err = app.models.Users.UnsuspendExpired(ctx)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		app.logger.WithFields(log.Fields{"user_id": id}).Info("expired suspension lifted")
+	}
+
+	return nil
+}
+
+// purgeDeletedUsers permanently removes the users which were soft-deleted longer ago
+// than the retention period.
+func (app *Application) purgeDeletedUsers(ctx context.Context) error {
+	var userIDs []uuid.UUID
+
+	err := app.models.Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		userIDs, err = app.models.Users.PurgeDeleted(ctx, time.Now().Add(-app.cfg.Jobs.UserRetention))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, id := range userIDs {
+		app.logger.WithFields(log.Fields{"user_id": id}).Info("deleted user purged")
+	}
+
+	return nil
+}
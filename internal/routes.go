@@ -21,11 +21,44 @@ func (app *Application) Routes() http.Handler {
 	router.HandlerFunc(http.MethodPut, "/v1/users/activated", app.handlers.ActivateUserHandler)
 
 	router.HandlerFunc(http.MethodGet, "/v1/users", app.middlewares.RequirePermission("users:list", app.handlers.ListUsersHandler))
-	router.HandlerFunc(http.MethodGet, "/v1/users/:id", app.middlewares.RequirePermission("users:show", app.handlers.ShowUserHandler))
-	router.HandlerFunc(http.MethodPatch, "/v1/users/:id", app.middlewares.RequirePermission("users:edit", app.handlers.UpdateUserHandler))
-	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.middlewares.RequirePermission("users:delete", app.handlers.DeleteUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id", app.middlewares.RequireActivatedUser(app.handlers.ShowUserHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/:id", app.middlewares.RequireActivatedUser(app.handlers.UpdateUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:id", app.middlewares.RequireActivatedUser(app.handlers.DeleteUserHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/users/:id/access", app.middlewares.RequireActivatedUser(app.handlers.ShowUserAccessHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/users/:id/flags", app.middlewares.RequireSuperuser(app.handlers.UpdateUserFlagsHandler))
+	router.HandlerFunc(http.MethodPut, "/v1/users/:id/suspension", app.middlewares.RequirePermission("users:suspend", app.handlers.SuspendUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:id/suspension", app.middlewares.RequirePermission("users:suspend", app.handlers.UnsuspendUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/:id/export", app.middlewares.RequireActivatedUser(app.handlers.ExportUserDataHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/:id/erase", app.middlewares.RequireActivatedUser(app.handlers.EraseUserHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/users/:id/grants", app.middlewares.RequirePermission("users:grant", app.handlers.GrantUserAccessHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:id/roles/:code", app.middlewares.RequirePermission("users:grant", app.handlers.RevokeUserRoleHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/users/:id/permissions/:code", app.middlewares.RequirePermission("users:grant", app.handlers.RevokeUserPermissionHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/exports", app.handlers.DownloadUserExportHandler)
+
+	router.HandlerFunc(http.MethodGet, "/v1/deleted-users", app.middlewares.RequirePermission("users:restore", app.handlers.ListDeletedUsersHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/deleted-users/:id/restore", app.middlewares.RequirePermission("users:restore", app.handlers.RestoreUserHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/deleted-users/:id", app.middlewares.RequirePermission("users:purge", app.handlers.PurgeUserHandler))
+
+	router.HandlerFunc(http.MethodGet, "/v1/groups", app.middlewares.RequirePermission("groups:list", app.handlers.ListGroupsHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/groups", app.middlewares.RequirePermission("groups:edit", app.handlers.CreateGroupHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/groups/:id", app.middlewares.RequirePermission("groups:list", app.handlers.ShowGroupHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/groups/:id", app.middlewares.RequirePermission("groups:edit", app.handlers.UpdateGroupHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/groups/:id", app.middlewares.RequirePermission("groups:edit", app.handlers.DeleteGroupHandler))
+	router.HandlerFunc(http.MethodPost, "/v1/groups/:id/members", app.middlewares.RequirePermission("groups:edit", app.handlers.AddGroupMembersHandler))
+	router.HandlerFunc(http.MethodDelete, "/v1/groups/:id/members/:user_id", app.middlewares.RequirePermission("groups:edit", app.handlers.RemoveGroupMemberHandler))
+
+	router.HandlerFunc(http.MethodPost, "/v1/orgs", app.middlewares.RequireActivatedUser(app.handlers.CreateOrganizationHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs", app.middlewares.RequireActivatedUser(app.handlers.ListOrganizationsHandler))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id", app.middlewares.RequireOrganization(app.handlers.ShowOrganizationHandler))
+	router.HandlerFunc(http.MethodPatch, "/v1/orgs/:org_id", app.middlewares.RequireOrganization(app.middlewares.RequirePermission("orgs:edit", app.handlers.UpdateOrganizationHandler)))
+	router.HandlerFunc(http.MethodGet, "/v1/orgs/:org_id/members", app.middlewares.RequireOrganization(app.middlewares.RequirePermission("orgs:members:list", app.handlers.ListOrganizationMembersHandler)))
+	router.HandlerFunc(http.MethodPost, "/v1/orgs/:org_id/members", app.middlewares.RequireOrganization(app.middlewares.RequirePermission("orgs:members:edit", app.handlers.AddOrganizationMemberHandler)))
+	router.HandlerFunc(http.MethodDelete, "/v1/orgs/:org_id/members/:user_id", app.middlewares.RequireOrganization(app.middlewares.RequirePermission("orgs:members:edit", app.handlers.RemoveOrganizationMemberHandler)))
+
+	router.HandlerFunc(http.MethodGet, "/v1/audit-events", app.middlewares.RequirePermission("audit:list", app.handlers.ListAuditEventsHandler))
 
 	router.Handler(http.MethodGet, "/debug/vars", expvar.Handler())
 
-	return app.middlewares.Metrics(app.middlewares.RecoverPanic(app.middlewares.EnableCORS(app.middlewares.RateLimit(app.middlewares.Authenticate(router)))))
+	return app.middlewares.Metrics(app.middlewares.RequestID(app.middlewares.RecoverPanic(app.middlewares.EnableCORS(app.middlewares.RateLimit(app.middlewares.Authenticate(app.middlewares.ReadYourWrites(app.middlewares.TenantTransaction(app.middlewares.Tenant(app.middlewares.EnforcePolicy(router))))))))))
 }
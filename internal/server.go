@@ -22,6 +22,18 @@ func (app *Application) Serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Reload the authorization policy file when it changes, until the server shuts down.
+	if app.enforcer != nil && app.cfg.Authz.ReloadInterval > 0 {
+		app.wg.Add(1)
+
+		go func() {
+			defer app.wg.Done()
+			app.enforcer.Watch(app.cfg.Authz.ReloadInterval, app.logger, app.quit)
+		}()
+	}
+
+	app.startJobs()
+
 	// shutdownError channel will be used to receive any errors returned
 	// by the graceful Shutdown() function.
 	shutdownError := make(chan error)
@@ -55,6 +67,8 @@ func (app *Application) Serve() error {
 			shutdownError <- err
 		}
 
+		close(app.quit)
+
 		app.logger.WithFields(log.Fields{"addr": srv.Addr}).Info("completing background tasks")
 		app.wg.Wait()
 		shutdownError <- nil
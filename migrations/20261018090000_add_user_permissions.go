@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddUserPermissions, downAddUserPermissions)
+}
+
+func upAddUserPermissions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('*', 'Everything'),
+	('users:*', 'Everything on users'),
+	('users:list', 'List users'),
+	('users:show:own', 'Show own user'),
+	('users:show:any', 'Show any user'),
+	('users:edit:own', 'Edit own user'),
+	('users:edit:any', 'Edit any user'),
+	('users:delete:own', 'Delete own user'),
+	('users:delete:any', 'Delete any user')
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO roles_permissions (role_id, permission_id)
+	SELECT r.role_id, p.permission_id
+	FROM roles r
+	JOIN permissions p ON (r.code, p.code) IN (
+		('user', 'users:show:own'),
+		('user', 'users:edit:own'),
+		('manager', 'users:list'),
+		('manager', 'users:show:any'),
+		('admin', '*')
+	)
+	`)
+	return err
+}
+
+func downAddUserPermissions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	DELETE FROM permissions WHERE code IN (
+		'*', 'users:*', 'users:list',
+		'users:show:own', 'users:show:any',
+		'users:edit:own', 'users:edit:any',
+		'users:delete:own', 'users:delete:any'
+	)
+	`)
+	return err
+}
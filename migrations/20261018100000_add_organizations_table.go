@@ -0,0 +1,104 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddOrganizationsTable, downAddOrganizationsTable)
+}
+
+func upAddOrganizationsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS organizations (
+		organization_id UUID PRIMARY KEY DEFAULT uuid_generate_v1(),
+		name varchar(150) NOT NULL,
+		created_at timestamptz DEFAULT NOW(),
+		updated_at timestamptz DEFAULT NOW(),
+		deleted_at timestamptz,
+		version integer NOT NULL DEFAULT 1
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS organizations_users (
+		organization_id UUID NOT NULL REFERENCES organizations ON DELETE CASCADE,
+		user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+		created_at timestamptz DEFAULT NOW(),
+		PRIMARY KEY (organization_id, user_id)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS organizations_users_roles (
+		organization_id UUID NOT NULL,
+		user_id UUID NOT NULL,
+		role_id UUID NOT NULL REFERENCES roles ON DELETE CASCADE,
+		PRIMARY KEY (organization_id, user_id, role_id),
+		FOREIGN KEY (organization_id, user_id) REFERENCES organizations_users ON DELETE CASCADE
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO roles (code, description) VALUES
+	('owner', 'Owner of an organization'),
+	('member', 'Member of an organization')
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('orgs:*', 'Everything on organizations'),
+	('orgs:edit', 'Edit the organization'),
+	('orgs:members:list', 'List the members of the organization'),
+	('orgs:members:edit', 'Add and remove members of the organization')
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO roles_permissions (role_id, permission_id)
+	SELECT r.role_id, p.permission_id
+	FROM roles r
+	JOIN permissions p ON (r.code, p.code) IN (
+		('owner', 'orgs:*'),
+		('member', 'orgs:members:list')
+	)
+	`)
+	return err
+}
+
+func downAddOrganizationsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM permissions WHERE code LIKE 'orgs:%'`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM roles WHERE code IN ('owner', 'member')`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE organizations_users_roles`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE organizations_users`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE organizations`)
+	return err
+}
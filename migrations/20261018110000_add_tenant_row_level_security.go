@@ -0,0 +1,123 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddTenantRowLevelSecurity, downAddTenantRowLevelSecurity)
+}
+
+// Row level security on the tenant scoped tables. The policies fail closed: a connection
+// sees the rows of the tenant in app.current_tenant (see data.SetSessionTenant), and
+// none at all without it, unless app.bypass_rls is on. The api, the CLIs and the
+// migrations turn the bypass on for their connections (see data.BypassRLSDSN) and the
+// requests within an organization turn it off again for their transaction.
+// FORCE makes the policies apply to the table owner as well, which is usually the role
+// the api connects with.
+func upAddTenantRowLevelSecurity(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE OR REPLACE FUNCTION app_current_tenant() RETURNS uuid AS $$
+		SELECT NULLIF(current_setting('app.current_tenant', true), '')::uuid
+	$$ LANGUAGE sql STABLE
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE OR REPLACE FUNCTION app_current_user() RETURNS uuid AS $$
+		SELECT NULLIF(current_setting('app.current_user', true), '')::uuid
+	$$ LANGUAGE sql STABLE
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE OR REPLACE FUNCTION app_rls_bypassed() RETURNS boolean AS $$
+		SELECT coalesce(current_setting('app.bypass_rls', true), '') = 'on'
+	$$ LANGUAGE sql STABLE
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"organizations", "organizations_users", "organizations_users_roles"} {
+		_, err = tx.Exec(`ALTER TABLE ` + table + ` ENABLE ROW LEVEL SECURITY`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`ALTER TABLE ` + table + ` FORCE ROW LEVEL SECURITY`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		CREATE POLICY tenant_isolation ON ` + table + `
+		USING (app_rls_bypassed() OR organization_id = app_current_tenant())
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	// within an organization, only its members (and the current user) are visible
+	_, err = tx.Exec(`ALTER TABLE users ENABLE ROW LEVEL SECURITY`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE users FORCE ROW LEVEL SECURITY`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE POLICY tenant_isolation ON users
+	USING (
+		app_rls_bypassed()
+		OR user_id = app_current_user()
+		OR EXISTS (
+			SELECT 1 FROM organizations_users ou
+			WHERE ou.user_id = users.user_id AND ou.organization_id = app_current_tenant()
+		)
+	)
+	`)
+	return err
+}
+
+func downAddTenantRowLevelSecurity(tx *sql.Tx) error {
+	for _, table := range []string{"users", "organizations_users_roles", "organizations_users", "organizations"} {
+		_, err := tx.Exec(`DROP POLICY IF EXISTS tenant_isolation ON ` + table)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`ALTER TABLE ` + table + ` NO FORCE ROW LEVEL SECURITY`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`ALTER TABLE ` + table + ` DISABLE ROW LEVEL SECURITY`)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`DROP FUNCTION IF EXISTS app_rls_bypassed()`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP FUNCTION IF EXISTS app_current_user()`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP FUNCTION IF EXISTS app_current_tenant()`)
+	return err
+}
@@ -0,0 +1,114 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddGroupsTable, downAddGroupsTable)
+}
+
+func upAddGroupsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS groups (
+		group_id UUID PRIMARY KEY DEFAULT uuid_generate_v1(),
+		name varchar(150) NOT NULL,
+		created_at timestamptz DEFAULT NOW(),
+		updated_at timestamptz DEFAULT NOW(),
+		version integer NOT NULL DEFAULT 1,
+		CONSTRAINT groups_name_key UNIQUE (name)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS groups_users (
+		group_id UUID NOT NULL REFERENCES groups ON DELETE CASCADE,
+		user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+		PRIMARY KEY (group_id, user_id)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS groups_users_user_id_idx ON groups_users (user_id)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS groups_roles (
+		group_id UUID NOT NULL REFERENCES groups ON DELETE CASCADE,
+		role_id UUID NOT NULL REFERENCES roles ON DELETE CASCADE,
+		PRIMARY KEY (group_id, role_id)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TABLE IF NOT EXISTS groups_permissions (
+		group_id UUID NOT NULL REFERENCES groups ON DELETE CASCADE,
+		permission_id UUID NOT NULL REFERENCES permissions ON DELETE CASCADE,
+		PRIMARY KEY (group_id, permission_id)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('groups:*', 'Everything on groups'),
+	('groups:list', 'List and show groups'),
+	('groups:edit', 'Create, edit and delete groups and their members'),
+	('users:access:own', 'Show own effective roles and permissions'),
+	('users:access:any', 'Show the effective roles and permissions of any user')
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO roles_permissions (role_id, permission_id)
+	SELECT r.role_id, p.permission_id
+	FROM roles r
+	JOIN permissions p ON (r.code, p.code) IN (
+		('user', 'users:access:own'),
+		('manager', 'groups:list'),
+		('manager', 'users:access:any')
+	)
+	`)
+	return err
+}
+
+func downAddGroupsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	DELETE FROM permissions WHERE code IN (
+		'groups:*', 'groups:list', 'groups:edit', 'users:access:own', 'users:access:any'
+	)
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE groups_permissions`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE groups_roles`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE groups_users`)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DROP TABLE groups`)
+	return err
+}
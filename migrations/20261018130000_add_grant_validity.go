@@ -0,0 +1,67 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddGrantValidity, downAddGrantValidity)
+}
+
+func upAddGrantValidity(tx *sql.Tx) error {
+	for _, table := range []string{"users_roles", "users_permissions"} {
+		_, err := tx.Exec(`
+		ALTER TABLE ` + table + `
+			ADD COLUMN IF NOT EXISTS valid_from timestamptz NOT NULL DEFAULT NOW(),
+			ADD COLUMN IF NOT EXISTS valid_until timestamptz,
+			ADD COLUMN IF NOT EXISTS reason text NOT NULL DEFAULT '',
+			ADD CONSTRAINT ` + table + `_validity_check CHECK (valid_until IS NULL OR valid_until > valid_from)
+		`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		CREATE INDEX IF NOT EXISTS ` + table + `_valid_until_idx ON ` + table + ` (valid_until)
+		WHERE valid_until IS NOT NULL
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('users:grant', 'Grant and revoke roles and permissions of users')
+	`)
+	return err
+}
+
+func downAddGrantValidity(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM permissions WHERE code = 'users:grant'`)
+	if err != nil {
+		return err
+	}
+
+	for _, table := range []string{"users_roles", "users_permissions"} {
+		_, err := tx.Exec(`DROP INDEX IF EXISTS ` + table + `_valid_until_idx`)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(`
+		ALTER TABLE ` + table + `
+			DROP CONSTRAINT IF EXISTS ` + table + `_validity_check,
+			DROP COLUMN IF EXISTS valid_from,
+			DROP COLUMN IF EXISTS valid_until,
+			DROP COLUMN IF EXISTS reason
+		`)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddAuditEventsTable, downAddAuditEventsTable)
+}
+
+func upAddAuditEventsTable(tx *sql.Tx) error {
+	// actor_id and target_id aren't foreign keys, the events have to outlive the
+	// records they are about
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS audit_events (
+		audit_event_id UUID PRIMARY KEY DEFAULT uuid_generate_v1(),
+		actor_id UUID,
+		organization_id UUID,
+		action varchar(100) NOT NULL,
+		target_type varchar(100) NOT NULL DEFAULT '',
+		target_id text NOT NULL DEFAULT '',
+		changes jsonb NOT NULL DEFAULT '{}',
+		ip text NOT NULL DEFAULT '',
+		request_id text NOT NULL DEFAULT '',
+		created_at timestamptz NOT NULL DEFAULT NOW()
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range []string{
+		`CREATE INDEX IF NOT EXISTS audit_events_created_at_idx ON audit_events (created_at)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_actor_id_idx ON audit_events (actor_id)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_target_idx ON audit_events (target_type, target_id)`,
+		`CREATE INDEX IF NOT EXISTS audit_events_action_idx ON audit_events (action)`,
+	} {
+		_, err = tx.Exec(index)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('audit:list', 'List audit events')
+	`)
+	return err
+}
+
+func downAddAuditEventsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM permissions WHERE code = 'audit:list'`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE IF EXISTS audit_events`)
+	return err
+}
@@ -0,0 +1,197 @@
+package migrations
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddAuditHashChain, downAddAuditHashChain)
+}
+
+func upAddAuditHashChain(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE audit_events
+		ADD COLUMN IF NOT EXISTS sequence bigint,
+		ADD COLUMN IF NOT EXISTS prev_hash text NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS hash text
+	`)
+	if err != nil {
+		return err
+	}
+
+	// chain the events written so far, oldest first
+	rows, err := tx.Query(`
+	SELECT audit_event_id, actor_id, organization_id, action, target_type, target_id,
+		changes, ip, request_id, created_at
+	FROM audit_events
+	ORDER BY created_at, audit_event_id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	events := []*chainedAuditEvent{}
+	for rows.Next() {
+		var event chainedAuditEvent
+
+		err := rows.Scan(
+			&event.AuditEventID, &event.ActorID, &event.OrganizationID, &event.Action,
+			&event.TargetType, &event.TargetID, &event.Changes, &event.IP, &event.RequestID,
+			&event.CreatedAt,
+		)
+		if err != nil {
+			return err
+		}
+
+		events = append(events, &event)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	prevHash := ""
+	for i, event := range events {
+		event.Sequence = int64(i + 1)
+		event.PrevHash = prevHash
+
+		event.Hash, err = event.computeHash()
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(
+			`UPDATE audit_events SET sequence = $1, prev_hash = $2, hash = $3 WHERE audit_event_id = $4`,
+			event.Sequence, event.PrevHash, event.Hash, event.AuditEventID,
+		)
+		if err != nil {
+			return err
+		}
+
+		prevHash = event.Hash
+	}
+
+	_, err = tx.Exec(`
+	ALTER TABLE audit_events
+		ALTER COLUMN sequence SET NOT NULL,
+		ALTER COLUMN hash SET NOT NULL,
+		ADD CONSTRAINT audit_events_sequence_key UNIQUE (sequence)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// the chain detects changes, this stops the accidental ones
+	_, err = tx.Exec(`
+	CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'audit events can not be updated or deleted';
+	END;
+	$$ LANGUAGE plpgsql
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE TRIGGER audit_events_append_only
+	BEFORE UPDATE OR DELETE ON audit_events
+	FOR EACH ROW EXECUTE FUNCTION audit_events_append_only()
+	`)
+	return err
+}
+
+// chainedAuditEvent is an audit event as chained by this migration. The hash is a frozen
+// copy of AuditEvent.ComputeHash at the time, which later changes to the application
+// must not affect.
+type chainedAuditEvent struct {
+	AuditEventID   uuid.UUID
+	Sequence       int64
+	ActorID        uuid.NullUUID
+	OrganizationID uuid.NullUUID
+	Action         string
+	TargetType     string
+	TargetID       string
+	Changes        []byte
+	IP             string
+	RequestID      string
+	CreatedAt      time.Time
+	PrevHash       string
+	Hash           string
+}
+
+func (e *chainedAuditEvent) computeHash() (string, error) {
+	// jsonb doesn't keep the formatting, so hash the changes as decoded from JSON
+	var decoded interface{}
+	err := json.Unmarshal(e.Changes, &decoded)
+	if err != nil {
+		return "", err
+	}
+
+	changes, err := json.Marshal(decoded)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(struct {
+		AuditEventID   uuid.UUID       `json:"audit_event_id"`
+		Sequence       int64           `json:"sequence"`
+		ActorID        uuid.NullUUID   `json:"actor_id"`
+		OrganizationID uuid.NullUUID   `json:"organization_id"`
+		Action         string          `json:"action"`
+		TargetType     string          `json:"target_type"`
+		TargetID       string          `json:"target_id"`
+		Changes        json.RawMessage `json:"changes"`
+		IP             string          `json:"ip"`
+		RequestID      string          `json:"request_id"`
+		CreatedAt      string          `json:"created_at"`
+		PrevHash       string          `json:"prev_hash"`
+	}{
+		AuditEventID:   e.AuditEventID,
+		Sequence:       e.Sequence,
+		ActorID:        e.ActorID,
+		OrganizationID: e.OrganizationID,
+		Action:         e.Action,
+		TargetType:     e.TargetType,
+		TargetID:       e.TargetID,
+		Changes:        changes,
+		IP:             e.IP,
+		RequestID:      e.RequestID,
+		CreatedAt:      e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		PrevHash:       e.PrevHash,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func downAddAuditHashChain(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP TRIGGER IF EXISTS audit_events_append_only ON audit_events`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP FUNCTION IF EXISTS audit_events_append_only()`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	ALTER TABLE audit_events
+		DROP CONSTRAINT IF EXISTS audit_events_sequence_key,
+		DROP COLUMN IF EXISTS sequence,
+		DROP COLUMN IF EXISTS prev_hash,
+		DROP COLUMN IF EXISTS hash
+	`)
+	return err
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddUserSuspension, downAddUserSuspension)
+}
+
+func upAddUserSuspension(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	ALTER TABLE users
+		ADD COLUMN IF NOT EXISTS suspended_at timestamptz,
+		ADD COLUMN IF NOT EXISTS suspended_until timestamptz,
+		ADD COLUMN IF NOT EXISTS suspension_reason text NOT NULL DEFAULT '',
+		ADD COLUMN IF NOT EXISTS suspended_by UUID REFERENCES users ON DELETE SET NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	CREATE INDEX IF NOT EXISTS users_suspended_until_idx ON users (suspended_until)
+	WHERE suspended_at IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('users:suspend', 'Suspend and unsuspend users')
+	`)
+	return err
+}
+
+func downAddUserSuspension(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM permissions WHERE code = 'users:suspend'`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP INDEX IF EXISTS users_suspended_until_idx`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	ALTER TABLE users
+		DROP COLUMN IF EXISTS suspended_at,
+		DROP COLUMN IF EXISTS suspended_until,
+		DROP COLUMN IF EXISTS suspension_reason,
+		DROP COLUMN IF EXISTS suspended_by
+	`)
+	return err
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"database/sql"
+	"log"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddUsersEmailKey, downAddUsersEmailKey)
+}
+
+func upAddUsersEmailKey(tx *sql.Tx) error {
+	// the first user keeps an email address taken several times, the others get a
+	// placeholder (like erased users) and are reported so they can be sorted out
+	rows, err := tx.Query(`
+	UPDATE users u SET email = 'duplicate-' || u.user_id || '@duplicate.invalid'
+	WHERE u.deleted_at IS NULL AND EXISTS (
+		SELECT 1 FROM users o
+		WHERE lower(o.email) = lower(u.email)
+		AND o.deleted_at IS NULL
+		AND (o.created_at, o.user_id) < (u.created_at, u.user_id)
+	)
+	RETURNING u.user_id
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return err
+		}
+		log.Printf("user %s had a duplicate email address, it was replaced by a placeholder", userID)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	// email addresses differing only by case are the same. Soft-deleted users don't
+	// keep their email address taken, restoring one re-checks it against this index.
+	_, err = tx.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS users_email_key ON users (lower(email))
+	WHERE deleted_at IS NULL
+	`)
+	return err
+}
+
+func downAddUsersEmailKey(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP INDEX IF EXISTS users_email_key`)
+	return err
+}
@@ -0,0 +1,25 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddDeletedUsersPermissions, downAddDeletedUsersPermissions)
+}
+
+func upAddDeletedUsersPermissions(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('users:restore', 'List and restore deleted users'),
+	('users:purge', 'Permanently remove deleted users')
+	`)
+	return err
+}
+
+func downAddDeletedUsersPermissions(tx *sql.Tx) error {
+	_, err := tx.Exec(`DELETE FROM permissions WHERE code IN ('users:restore', 'users:purge')`)
+	return err
+}
@@ -0,0 +1,79 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddDataExportsTable, downAddDataExportsTable)
+}
+
+func upAddDataExportsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	CREATE TABLE IF NOT EXISTS data_exports (
+		export_id UUID PRIMARY KEY DEFAULT uuid_generate_v1(),
+		user_id UUID NOT NULL REFERENCES users ON DELETE CASCADE,
+		status varchar(20) NOT NULL DEFAULT 'pending',
+		content bytea,
+		created_at timestamptz NOT NULL DEFAULT NOW(),
+		expires_at timestamptz
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS data_exports_user_id_idx ON data_exports (user_id)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE users ADD COLUMN IF NOT EXISTS erased_at timestamptz`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO permissions (code, description) VALUES
+	('users:export:own', 'Export own personal data'),
+	('users:export:any', 'Export the personal data of any user'),
+	('users:erase:own', 'Erase own personal data'),
+	('users:erase:any', 'Erase the personal data of any user')
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+	INSERT INTO roles_permissions (role_id, permission_id)
+	SELECT r.role_id, p.permission_id
+	FROM roles r
+	JOIN permissions p ON (r.code, p.code) IN (
+		('user', 'users:export:own'),
+		('user', 'users:erase:own')
+	)
+	`)
+	return err
+}
+
+func downAddDataExportsTable(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	DELETE FROM permissions WHERE code IN (
+		'users:export:own', 'users:export:any',
+		'users:erase:own', 'users:erase:any'
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`ALTER TABLE users DROP COLUMN IF EXISTS erased_at`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DROP TABLE IF EXISTS data_exports`)
+	return err
+}
@@ -0,0 +1,46 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddUsersUsernameKey, downAddUsersUsernameKey)
+}
+
+func upAddUsersUsernameKey(tx *sql.Tx) error {
+	// registration used to accept empty usernames
+	_, err := tx.Exec(`UPDATE users SET username = 'user-' || user_id WHERE username = ''`)
+	if err != nil {
+		return err
+	}
+
+	// the first user keeps a username taken several times, the others get a suffix
+	_, err = tx.Exec(`
+	UPDATE users u SET username = left(u.username, 140) || '-' || left(u.user_id::text, 8)
+	WHERE u.deleted_at IS NULL AND EXISTS (
+		SELECT 1 FROM users o
+		WHERE lower(o.username) = lower(u.username)
+		AND o.deleted_at IS NULL
+		AND (o.created_at, o.user_id) < (u.created_at, u.user_id)
+	)
+	`)
+	if err != nil {
+		return err
+	}
+
+	// usernames differing only by case are the same, and like email addresses they are
+	// freed by soft-deleting the user
+	_, err = tx.Exec(`
+	CREATE UNIQUE INDEX IF NOT EXISTS users_username_key ON users (lower(username))
+	WHERE deleted_at IS NULL
+	`)
+	return err
+}
+
+func downAddUsersUsernameKey(tx *sql.Tx) error {
+	_, err := tx.Exec(`DROP INDEX IF EXISTS users_username_key`)
+	return err
+}
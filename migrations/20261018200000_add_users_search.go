@@ -0,0 +1,52 @@
+package migrations
+
+import (
+	"database/sql"
+
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigration(upAddUsersSearch, downAddUsersSearch)
+}
+
+func upAddUsersSearch(tx *sql.Tx) error {
+	_, err := tx.Exec(`CREATE EXTENSION IF NOT EXISTS pg_trgm`)
+	if err != nil {
+		return err
+	}
+
+	// the names weigh more than the username and email address, whose domain is split
+	// off so it can be searched on its own
+	_, err = tx.Exec(`
+	ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS search tsvector GENERATED ALWAYS AS (
+		setweight(to_tsvector('simple', coalesce(first_name, '') || ' ' || coalesce(last_name, '')), 'A') ||
+		setweight(to_tsvector('simple', coalesce(username, '') || ' ' || replace(coalesce(email, ''), '@', ' ')), 'B')
+	) STORED,
+	ADD COLUMN IF NOT EXISTS search_text text GENERATED ALWAYS AS (
+		lower(coalesce(first_name, '') || ' ' || coalesce(last_name, '') || ' ' || coalesce(username, '') || ' ' || coalesce(email, ''))
+	) STORED
+	`)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS users_search_idx ON users USING GIN (search)`)
+	if err != nil {
+		return err
+	}
+
+	// for the similarity of misspelled searches
+	_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS users_search_text_trgm_idx ON users USING GIN (search_text gin_trgm_ops)`)
+	return err
+}
+
+func downAddUsersSearch(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+	DROP INDEX IF EXISTS users_search_text_trgm_idx;
+	DROP INDEX IF EXISTS users_search_idx;
+	ALTER TABLE users DROP COLUMN IF EXISTS search_text, DROP COLUMN IF EXISTS search;
+	`)
+	return err
+}